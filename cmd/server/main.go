@@ -9,8 +9,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/you/go-jobsity-flights/internal/airports"
 	"github.com/you/go-jobsity-flights/internal/auth"
+	"github.com/you/go-jobsity-flights/internal/cache"
 	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/fx"
 	"github.com/you/go-jobsity-flights/internal/httpx"
 	"github.com/you/go-jobsity-flights/internal/providers"
 	"github.com/you/go-jobsity-flights/internal/service"
@@ -21,16 +24,55 @@ func main() {
 	// Loading config
 	cfg := config.Load()
 
-	// Creating flight provider slice out of config parameters
-	prov := []providers.FlightProvider{
+	// Creating flight provider slice out of config parameters, each with
+	// its own rate limiter and quotas (rate_limits), retries and circuit
+	// breaker
+	retry := providers.RetryPolicy{
+		MaxAttempts: cfg.RetryAttempts,
+		BaseDelay:   cfg.RetryBaseDelay,
+		MaxDelay:    providers.DefaultRetryPolicy.MaxDelay,
+	}
+	breaker := providers.BreakerPolicy{FailureThreshold: cfg.BreakerThreshold, Cooldown: cfg.BreakerCooldown}
+	var prov []providers.FlightProvider
+	for _, p := range []providers.FlightProvider{
 		providers.NewAmadeus(cfg),
 		providers.NewDuffel(cfg),
 		providers.NewRapidBooking(cfg),
+	} {
+		prov = append(prov, providers.NewResilient(p, retry, breaker))
+	}
+
+	// Embedded airport reference: city expansion, validation, autocomplete
+	airportDB := airports.Default()
+	opts := []service.Option{service.WithAirports(airportDB)}
+
+	opts = append(opts,
+		service.WithCache(resultCache(cfg)),
+		service.WithSnapshotStore(snapshotStore(cfg)),
+		service.WithStaleWindow(cfg.CacheStale),
+		service.WithNegativeTTL(cfg.CacheNegativeTTL),
+		service.WithProviderTimeouts(cfg.ProviderTimeouts),
+		service.WithHedging(cfg.HedgePercentile),
+	)
+
+	// Currency normalisation, when a rate source is configured
+	if src := fxSource(cfg); src != nil {
+		conv := fx.NewConverter(src, cfg.FXRefresh)
+		if err := conv.Refresh(context.Background()); err != nil {
+			log.Printf("fx rates not loaded yet: %v", err)
+		}
+		go conv.Run(context.Background())
+		opts = append(opts, service.WithConverter(conv))
 	}
 
 	// Creating services
-	searchSvc := service.NewSearchService(prov, cfg.SearchTimeout, cfg.CacheTTL)
+	searchSvc := service.NewSearchService(prov, cfg.SearchTimeout, cfg.CacheTTL, opts...)
 	histSvc := service.NewHistoryService()
+	// one poller per live search, shared by its SSE and WS subscribers
+	hub := service.NewHub(searchSvc, cfg.StreamInterval)
+	// recent SSE events per client, replayed when it reconnects
+	sseSessions := service.NewStreamSessions(service.DefaultReplaySize, service.DefaultResumeWindow)
+	go sseSessions.Run(context.Background(), time.Minute)
 
 	publicMux := http.NewServeMux()
 
@@ -40,9 +82,14 @@ func main() {
 	// Protected group with JWT
 	protectedMux := http.NewServeMux()
 	protectedMux.HandleFunc("/flights/search", httpx.SearchHandler(searchSvc))
+	protectedMux.HandleFunc("/flights/calendar", httpx.CalendarHandler(searchSvc))
 	protectedMux.HandleFunc("/flights/history", httpx.HistoryHandler(histSvc))
-	protectedMux.HandleFunc("/sse/", httpx.SubscribeSSEHandler(searchSvc))
-	protectedMux.HandleFunc("/ws/", httpx.SubscribeWSHandler(searchSvc))
+	protectedMux.HandleFunc("/airports", httpx.AirportsHandler(airportDB))
+	protectedMux.HandleFunc("/admin/cache", httpx.CacheStatsHandler(searchSvc))
+	protectedMux.HandleFunc("/admin/providers", httpx.BreakersHandler(searchSvc))
+	protectedMux.HandleFunc("/admin/quotas", httpx.QuotasHandler(searchSvc))
+	protectedMux.HandleFunc("/sse/", httpx.SubscribeSSEHandler(searchSvc, hub, sseSessions))
+	protectedMux.HandleFunc("/ws/", httpx.SubscribeWSHandler(searchSvc, hub))
 
 	// handler to control authenticated routes
 	root := auth.JWTMiddleware(publicMux, protectedMux, cfg)
@@ -76,3 +123,47 @@ func main() {
 	defer cancel()
 	_ = srv.Shutdown(ctx)
 }
+
+// resultCache shares results through Redis when redis_url is set, so
+// replicas do not query providers independently; otherwise it is a bounded
+// in-memory LRU swept for expired entries every minute.
+func resultCache(cfg *config.Config) cache.Cache[service.CacheEntry] {
+	if cfg.RedisURL != "" {
+		c, err := cache.NewRedis[service.CacheEntry](cfg.RedisURL, "flights:search:")
+		if err != nil {
+			log.Fatalf("redis cache: %v", err)
+		}
+		return c
+	}
+	lru := service.NewResultCache(cfg.CacheMaxEntries, cfg.CacheMaxBytes)
+	go lru.Run(context.Background(), time.Minute)
+	return lru
+}
+
+// snapshotStore keeps pagination snapshots in Redis next to the results
+// when redis_url is set, so a cursor works on every replica; otherwise
+// they stay in a bounded in-memory LRU local to this process.
+func snapshotStore(cfg *config.Config) cache.Cache[service.Snapshot] {
+	if cfg.RedisURL != "" {
+		c, err := cache.NewRedis[service.Snapshot](cfg.RedisURL, "flights:snapshot:")
+		if err != nil {
+			log.Fatalf("redis snapshots: %v", err)
+		}
+		return c
+	}
+	lru := service.NewSnapshotStore(service.DefaultSnapshotEntries)
+	go lru.Run(context.Background(), time.Minute)
+	return lru
+}
+
+// fxSource picks the exchange rate source from config: a remote endpoint
+// wins over a local file; nil disables currency conversion.
+func fxSource(cfg *config.Config) fx.RateSource {
+	switch {
+	case cfg.FXRatesURL != "":
+		return fx.NewHTTPSource(cfg.FXRatesURL)
+	case cfg.FXRatesFile != "":
+		return fx.NewFileSource(cfg.FXRatesFile)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package airports is an embedded reference of airports and the
+// metropolitan (city) codes grouping them.
+package airports
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // airport zones must resolve even without OS zoneinfo
+)
+
+//go:embed airports.csv
+var airportsCSV string
+
+type Airport struct {
+	Code     string  `json:"code"`
+	Name     string  `json:"name"`
+	CityCode string  `json:"city_code"`
+	City     string  `json:"city"`
+	Country  string  `json:"country"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	TZ       string  `json:"tz"` // IANA zone, e.g. Europe/Amsterdam
+}
+
+// DB indexes airports by code and by city code.
+type DB struct {
+	list   []Airport
+	byCode map[string]Airport
+	byCity map[string][]Airport
+}
+
+var (
+	defaultOnce sync.Once
+	defaultDB   *DB
+)
+
+// Default returns the database embedded in the binary.
+func Default() *DB {
+	defaultOnce.Do(func() {
+		db, err := Parse(airportsCSV)
+		if err != nil {
+			panic("airports: embedded data: " + err.Error())
+		}
+		defaultDB = db
+	})
+	return defaultDB
+}
+
+// Parse reads a CSV with the header
+// code,name,city_code,city,country,lat,lon,tz.
+func Parse(data string) (*DB, error) {
+	rows, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{byCode: map[string]Airport{}, byCity: map[string][]Airport{}}
+	for i, r := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(r) != 8 {
+			return nil, fmt.Errorf("line %d: want 8 fields, got %d", i+1, len(r))
+		}
+		lat, err := strconv.ParseFloat(r[5], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad lat: %w", i+1, err)
+		}
+		lon, err := strconv.ParseFloat(r[6], 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad lon: %w", i+1, err)
+		}
+		a := Airport{Code: r[0], Name: r[1], CityCode: r[2], City: r[3], Country: r[4], Lat: lat, Lon: lon, TZ: r[7]}
+		db.list = append(db.list, a)
+		db.byCode[a.Code] = a
+		db.byCity[a.CityCode] = append(db.byCity[a.CityCode], a)
+	}
+	return db, nil
+}
+
+// Lookup finds an airport by its IATA code.
+func (db *DB) Lookup(code string) (Airport, bool) {
+	a, ok := db.byCode[strings.ToUpper(code)]
+	return a, ok
+}
+
+// CityAirports returns the airports of a metropolitan code such as LON.
+func (db *DB) CityAirports(cityCode string) []Airport {
+	return db.byCity[strings.ToUpper(cityCode)]
+}
+
+// IsCity reports whether code is a metropolitan code grouping several
+// airports. Codes that name an airport themselves (BCN, FRA) are not cities,
+// so searching for them never silently widens to the rest of the group.
+func (db *DB) IsCity(code string) bool {
+	code = strings.ToUpper(code)
+	if _, ok := db.byCode[code]; ok {
+		return false
+	}
+	return len(db.byCity[code]) > 1
+}
+
+// Known reports whether code is an airport or a city code in the database.
+func (db *DB) Known(code string) bool {
+	code = strings.ToUpper(code)
+	_, ok := db.byCode[code]
+	return ok || len(db.byCity[code]) > 0
+}
+
+// Location returns the time zone of an airport, or of the first airport of
+// a city code; UTC when the code or its zone is unknown.
+func (db *DB) Location(code string) *time.Location {
+	a, ok := db.Lookup(code)
+	if !ok {
+		city := db.CityAirports(code)
+		if len(city) == 0 {
+			return time.UTC
+		}
+		a = city[0]
+	}
+	return a.Location()
+}
+
+// Location loads the airport's IANA zone, falling back to UTC.
+func (a Airport) Location() *time.Location {
+	loc, err := time.LoadLocation(a.TZ)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Search ranks airports for autocomplete: exact code first, then code
+// prefixes, members of a matching city code, then name and city matches
+// (word prefixes before substrings). At most limit results are returned.
+func (db *DB) Search(q string, limit int) []Airport {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if q == "" || limit <= 0 {
+		return nil
+	}
+	type hit struct {
+		a    Airport
+		rank int
+	}
+	var hits []hit
+	for _, a := range db.list {
+		code, cityCode := strings.ToLower(a.Code), strings.ToLower(a.CityCode)
+		text := strings.ToLower(a.Name + " " + a.City)
+		rank := -1
+		switch {
+		case code == q:
+			rank = 0
+		case strings.HasPrefix(code, q):
+			rank = 1
+		case cityCode == q:
+			rank = 2
+		case hasWordPrefix(text, q):
+			rank = 3
+		case strings.Contains(text, q):
+			rank = 4
+		}
+		if rank >= 0 {
+			hits = append(hits, hit{a, rank})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].rank < hits[j].rank })
+	out := make([]Airport, 0, min(limit, len(hits)))
+	for _, h := range hits[:min(limit, len(hits))] {
+		out = append(out, h.a)
+	}
+	return out
+}
+
+func hasWordPrefix(text, prefix string) bool {
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool { return r == ' ' || r == '-' || r == '/' }) {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Nearby returns the airports within km of a, closest first, excluding a.
+func (db *DB) Nearby(a Airport, km float64) []Airport {
+	var out []Airport
+	for _, b := range db.list {
+		if b.Code != a.Code && DistanceKm(a, b) <= km {
+			out = append(out, b)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return DistanceKm(a, out[i]) < DistanceKm(a, out[j]) })
+	return out
+}
+
+// Expand turns a search code into concrete airport codes: a city code
+// yields its airports, and nearbyKm > 0 adds every airport within that
+// distance of them. Unknown codes are passed through untouched.
+func (db *DB) Expand(code string, nearbyKm float64) []string {
+	code = strings.ToUpper(code)
+	var base []Airport
+	if db.IsCity(code) {
+		base = db.CityAirports(code)
+	} else if a, ok := db.Lookup(code); ok {
+		base = []Airport{a}
+	} else {
+		return []string{code}
+	}
+
+	seen := map[string]bool{}
+	var out []string
+	add := func(a Airport) {
+		if !seen[a.Code] {
+			seen[a.Code] = true
+			out = append(out, a.Code)
+		}
+	}
+	for _, a := range base {
+		add(a)
+	}
+	if nearbyKm > 0 {
+		for _, a := range base {
+			for _, n := range db.Nearby(a, nearbyKm) {
+				add(n)
+			}
+		}
+	}
+	return out
+}
+
+// DistanceKm is the great-circle distance between two airports.
+func DistanceKm(a, b Airport) float64 {
+	const earthRadiusKm = 6371.0
+	rad := func(d float64) float64 { return d * math.Pi / 180 }
+	dLat, dLon := rad(b.Lat-a.Lat), rad(b.Lon-a.Lon)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,80 @@
+package airports
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultLoads(t *testing.T) {
+	db := Default()
+	a, ok := db.Lookup("lhr")
+	require.True(t, ok)
+	require.Equal(t, "LON", a.CityCode)
+	require.Equal(t, "Europe/London", a.TZ)
+
+	_, ok = db.Lookup("ZZZ")
+	require.False(t, ok)
+
+	require.Len(t, db.byCode, len(db.list), "duplicate codes")
+	for _, a := range db.list {
+		_, err := time.LoadLocation(a.TZ)
+		require.NoError(t, err, a.Code)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	db := Default()
+
+	require.ElementsMatch(t, []string{"LHR", "LGW", "STN", "LTN", "LCY", "SEN"}, db.Expand("LON", 0))
+	// BCN is an airport as well as a city code: it stays a single airport.
+	require.Equal(t, []string{"BCN"}, db.Expand("BCN", 0))
+	require.Equal(t, []string{"XYZ"}, db.Expand("xyz", 100))
+
+	near := db.Expand("BCN", 120)
+	require.Equal(t, "BCN", near[0])
+	require.Contains(t, near, "GRO")
+	require.Contains(t, near, "REU")
+	require.NotContains(t, near, "MAD")
+}
+
+func TestDistanceKm(t *testing.T) {
+	db := Default()
+	lhr, _ := db.Lookup("LHR")
+	jfk, _ := db.Lookup("JFK")
+	require.InDelta(t, 5540, DistanceKm(lhr, jfk), 20)
+	require.Zero(t, DistanceKm(lhr, lhr))
+}
+
+func TestParseRejectsBadRows(t *testing.T) {
+	_, err := Parse("code,name,city_code,city,country,lat,lon,tz\nAAA,A,AAA,A,XX,north,0,UTC\n")
+	require.Error(t, err)
+}
+
+func TestSearch(t *testing.T) {
+	db := Default()
+
+	got := db.Search("jfk", 5)
+	require.Equal(t, "JFK", got[0].Code)
+
+	got = db.Search("NYC", 10)
+	require.Len(t, got, 3)
+	for _, a := range got {
+		require.Equal(t, "NYC", a.CityCode)
+	}
+
+	got = db.Search("barc", 10)
+	require.NotEmpty(t, got)
+	require.Equal(t, "Barcelona", got[0].City)
+
+	require.Len(t, db.Search("a", 4), 4)
+	require.Empty(t, db.Search("  ", 4))
+}
+
+func TestLocation(t *testing.T) {
+	db := Default()
+	require.Equal(t, "Europe/London", db.Location("LON").String())
+	require.Equal(t, "America/New_York", db.Location("JFK").String())
+	require.Equal(t, time.UTC, db.Location("ZZZ"))
+}
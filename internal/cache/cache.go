@@ -0,0 +1,28 @@
+// Package cache holds the search result caches: the Cache interface the
+// service depends on and its backends.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Cache stores values under string keys until their TTL runs out.
+// Backends are safe for concurrent use; a backend failure reads as a miss.
+type Cache[V any] interface {
+	Get(ctx context.Context, key string) (V, bool)
+	Set(ctx context.Context, key string, v V, ttl time.Duration)
+	Delete(ctx context.Context, key string)
+	Stats() Stats
+}
+
+// Stats are cumulative counters plus the current size of a cache.
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"` // dropped to stay within bounds
+	Expired   uint64 `json:"expired"`   // removed by TTL, on read or by the janitor
+	Errors    uint64 `json:"errors,omitempty"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes,omitempty"`
+}
@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory cache bounded by entry count and, optionally, by an
+// estimated byte size. When either bound is exceeded the least recently
+// used entries are evicted.
+type LRU[V any] struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	size       func(V) int
+	ll         *list.List // front is most recently used
+	items      map[string]*list.Element
+	bytes      int64
+	stats      Stats
+	now        func() time.Time
+}
+
+type lruEntry[V any] struct {
+	key       string
+	value     V
+	size      int64
+	expiresAt time.Time
+}
+
+// NewLRU returns a cache holding at most maxEntries values (0 for no
+// limit). maxBytes > 0 also bounds the sum of size(v) over all entries.
+func NewLRU[V any](maxEntries int, maxBytes int64, size func(V) int) *LRU[V] {
+	if size == nil {
+		maxBytes = 0
+	}
+	return &LRU[V]{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		size:       size,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+func (c *LRU[V]) Get(_ context.Context, key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	e := el.Value.(*lruEntry[V])
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		c.stats.Expired++
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	return e.value, true
+}
+
+func (c *LRU[V]) Set(_ context.Context, key string, v V, ttl time.Duration) {
+	var size int64
+	if c.size != nil {
+		size = int64(c.size(v))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if c.maxBytes > 0 && size > c.maxBytes {
+		// would evict everything and still not fit
+		c.stats.Evictions++
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry[V]{key: key, value: v, size: size, expiresAt: c.now().Add(ttl)})
+	c.bytes += size
+	for c.overflow() {
+		c.remove(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *LRU[V]) Delete(_ context.Context, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+func (c *LRU[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Entries = c.ll.Len()
+	if c.size != nil {
+		st.Bytes = c.bytes
+	}
+	return st
+}
+
+// Sweep removes every expired entry and returns how many were dropped.
+func (c *LRU[V]) Sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	n := 0
+	for el := c.ll.Back(); el != nil; {
+		prev := el.Prev()
+		if !now.Before(el.Value.(*lruEntry[V]).expiresAt) {
+			c.remove(el)
+			n++
+		}
+		el = prev
+	}
+	c.stats.Expired += uint64(n)
+	return n
+}
+
+// Run is the janitor: it sweeps expired entries every interval until ctx
+// is done, so entries nobody reads again do not hold memory until evicted.
+func (c *LRU[V]) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.Sweep()
+		}
+	}
+}
+
+func (c *LRU[V]) overflow() bool {
+	return (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) ||
+		(c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+func (c *LRU[V]) remove(el *list.Element) {
+	e := c.ll.Remove(el).(*lruEntry[V])
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
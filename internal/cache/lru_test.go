@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestLRU(maxEntries int, maxBytes int64) (*LRU[string], *clock) {
+	clk := &clock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := NewLRU(maxEntries, maxBytes, func(s string) int { return len(s) })
+	c.now = clk.now
+	return c, clk
+}
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestLRU(2, 0)
+
+	c.Set(ctx, "a", "1", time.Minute)
+	c.Set(ctx, "b", "2", time.Minute)
+	_, ok := c.Get(ctx, "a") // a is now more recent than b
+	require.True(t, ok)
+	c.Set(ctx, "c", "3", time.Minute)
+
+	_, ok = c.Get(ctx, "b")
+	require.False(t, ok)
+	v, ok := c.Get(ctx, "a")
+	require.True(t, ok)
+	require.Equal(t, "1", v)
+
+	st := c.Stats()
+	require.EqualValues(t, 1, st.Evictions)
+	require.EqualValues(t, 2, st.Hits)
+	require.EqualValues(t, 1, st.Misses)
+	require.Equal(t, 2, st.Entries)
+}
+
+func TestLRU_BoundsBytes(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestLRU(0, 10)
+
+	c.Set(ctx, "a", "aaaa", time.Minute)
+	c.Set(ctx, "b", "bbbb", time.Minute)
+	c.Set(ctx, "c", "cccc", time.Minute) // 12 bytes: a goes
+	require.EqualValues(t, 8, c.Stats().Bytes)
+	_, ok := c.Get(ctx, "a")
+	require.False(t, ok)
+
+	// replacing a key accounts for the old size
+	c.Set(ctx, "b", "b", time.Minute)
+	require.EqualValues(t, 5, c.Stats().Bytes)
+
+	// larger than the whole cache: not stored
+	c.Set(ctx, "huge", "0123456789x", time.Minute)
+	_, ok = c.Get(ctx, "huge")
+	require.False(t, ok)
+	require.Equal(t, 2, c.Stats().Entries)
+}
+
+func TestLRU_ExpiryAndSweep(t *testing.T) {
+	ctx := context.Background()
+	c, clk := newTestLRU(0, 0)
+
+	c.Set(ctx, "short", "x", time.Second)
+	c.Set(ctx, "long", "y", time.Hour)
+	c.Set(ctx, "also-short", "z", time.Second)
+	clk.t = clk.t.Add(2 * time.Second)
+
+	_, ok := c.Get(ctx, "short")
+	require.False(t, ok)
+	require.Equal(t, 1, c.Sweep())
+
+	st := c.Stats()
+	require.EqualValues(t, 2, st.Expired)
+	require.Equal(t, 1, st.Entries)
+	_, ok = c.Get(ctx, "long")
+	require.True(t, ok)
+}
+
+func TestLRU_JanitorStopsWithContext(t *testing.T) {
+	c := NewLRU[string](0, 0, nil)
+	c.Set(context.Background(), "k", "v", time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx, 5*time.Millisecond)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return c.Stats().Entries == 0 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,264 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultRedisTimeout = 500 * time.Millisecond
+	defaultRedisIdle    = 8
+)
+
+// Redis is a Cache shared between replicas, speaking the Redis protocol
+// (RESP) to any compatible server. Values are stored as JSON. Network or
+// server failures are logged and read as misses so a cache outage only
+// costs provider calls.
+type Redis[V any] struct {
+	addr     string
+	username string
+	password string
+	db       int
+	prefix   string
+	timeout  time.Duration
+	idle     chan *redisConn
+
+	hits, misses, errors atomic.Uint64
+}
+
+// NewRedis connects lazily to the server in rawURL
+// (redis://[user:password@]host:port[/db]). Every key is stored under
+// prefix so several applications can share one server.
+func NewRedis[V any](rawURL, prefix string) (*Redis[V], error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("redis: bad url: %w", err)
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("redis: bad url %q, use redis://host:port[/db]", rawURL)
+	}
+	r := &Redis[V]{
+		addr:    u.Host,
+		prefix:  prefix,
+		timeout: defaultRedisTimeout,
+		idle:    make(chan *redisConn, defaultRedisIdle),
+	}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+		if r.password == "" {
+			// redis://secret@host is a common shorthand for a password only
+			r.username, r.password = "", r.username
+		}
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("redis: bad database %q", db)
+		}
+	}
+	return r, nil
+}
+
+func (r *Redis[V]) Get(ctx context.Context, key string) (V, bool) {
+	var zero V
+	reply, err := r.do(ctx, "GET", r.prefix+key)
+	if err != nil {
+		r.fail("get", err)
+		r.misses.Add(1)
+		return zero, false
+	}
+	b, ok := reply.([]byte)
+	if !ok {
+		r.misses.Add(1)
+		return zero, false
+	}
+	var v V
+	if err := json.Unmarshal(b, &v); err != nil {
+		r.fail("decode", err)
+		r.misses.Add(1)
+		return zero, false
+	}
+	r.hits.Add(1)
+	return v, true
+}
+
+func (r *Redis[V]) Set(ctx context.Context, key string, v V, ttl time.Duration) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		r.fail("encode", err)
+		return
+	}
+	ms := max(ttl.Milliseconds(), 1)
+	if _, err := r.do(ctx, "SET", r.prefix+key, string(b), "PX", strconv.FormatInt(ms, 10)); err != nil {
+		r.fail("set", err)
+	}
+}
+
+func (r *Redis[V]) Delete(ctx context.Context, key string) {
+	if _, err := r.do(ctx, "DEL", r.prefix+key); err != nil {
+		r.fail("del", err)
+	}
+}
+
+// Stats reports this replica's counters; the entry count lives on the
+// server and is not tracked.
+func (r *Redis[V]) Stats() Stats {
+	return Stats{Hits: r.hits.Load(), Misses: r.misses.Load(), Errors: r.errors.Load()}
+}
+
+// Close drops the idle connections.
+func (r *Redis[V]) Close() error {
+	for {
+		select {
+		case c := <-r.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (r *Redis[V]) fail(op string, err error) {
+	r.errors.Add(1)
+	log.Printf("redis cache %s: %v", op, err)
+}
+
+// do runs one command on a pooled connection. A connection that saw any
+// error is discarded rather than returned to the pool, since its reply
+// stream may be out of sync.
+func (r *Redis[V]) do(ctx context.Context, args ...string) (any, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > r.timeout {
+		deadline = time.Now().Add(r.timeout)
+	}
+	_ = c.SetDeadline(deadline)
+	reply, err := c.do(args...)
+	var serverErr redisError
+	if err != nil && !errors.As(err, &serverErr) {
+		c.Close()
+		return nil, err
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.Close()
+	}
+	return reply, err
+}
+
+func (r *Redis[V]) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case c := <-r.idle:
+		return c, nil
+	default:
+	}
+	d := net.Dialer{Timeout: r.timeout}
+	nc, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, rd: bufio.NewReader(nc)}
+	_ = c.SetDeadline(time.Now().Add(r.timeout))
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.username != "" {
+			args = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(r.db)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+type redisConn struct {
+	net.Conn
+	rd *bufio.Reader
+}
+
+// redisError is an error reply from the server (e.g. -WRONGPASS); the
+// connection itself is still usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (c *redisConn) do(args ...string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+// readReply decodes one RESP value: simple strings and integers as string
+// and int64, bulk strings as []byte (nil when absent), arrays as []any.
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		out := make([]any, n)
+		for i := range out {
+			if out[i], err = readReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
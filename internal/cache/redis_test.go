@@ -0,0 +1,281 @@
+package cache_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/cache"
+	"github.com/you/go-jobsity-flights/internal/money"
+	"github.com/you/go-jobsity-flights/internal/providers"
+	"github.com/you/go-jobsity-flights/internal/service"
+)
+
+// fakeRedis is an in-process RESP server implementing the handful of
+// commands the cache uses: AUTH, SELECT, PING, GET, SET [PX], DEL.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	data    map[string]string
+	expires map[string]time.Time
+	cmds    []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f := &fakeRedis{ln: ln, password: password, data: map[string]string{}, expires: map[string]time.Time{}}
+	go f.serve()
+	t.Cleanup(func() { ln.Close() })
+	return f
+}
+
+func (f *fakeRedis) url() string {
+	if f.password != "" {
+		return "redis://:" + f.password + "@" + f.ln.Addr().String() + "/2"
+	}
+	return "redis://" + f.ln.Addr().String()
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		c, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(c)
+	}
+}
+
+func (f *fakeRedis) handle(c net.Conn) {
+	defer c.Close()
+	rd := bufio.NewReader(c)
+	authed := f.password == ""
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		f.mu.Lock()
+		f.cmds = append(f.cmds, cmd)
+		f.mu.Unlock()
+		if !authed && cmd != "AUTH" {
+			io.WriteString(c, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+		switch cmd {
+		case "AUTH":
+			if args[len(args)-1] != f.password {
+				io.WriteString(c, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			authed = true
+			io.WriteString(c, "+OK\r\n")
+		case "SELECT", "PING":
+			io.WriteString(c, "+OK\r\n")
+		case "GET":
+			v, ok := f.get(args[1])
+			if !ok {
+				io.WriteString(c, "$-1\r\n")
+				continue
+			}
+			fmt.Fprintf(c, "$%d\r\n%s\r\n", len(v), v)
+		case "SET":
+			f.mu.Lock()
+			f.data[args[1]] = args[2]
+			delete(f.expires, args[1])
+			if len(args) == 5 && strings.EqualFold(args[3], "PX") {
+				ms, _ := strconv.Atoi(args[4])
+				f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			f.mu.Unlock()
+			io.WriteString(c, "+OK\r\n")
+		case "DEL":
+			f.mu.Lock()
+			_, ok := f.data[args[1]]
+			delete(f.data, args[1])
+			f.mu.Unlock()
+			fmt.Fprintf(c, ":%d\r\n", map[bool]int{true: 1}[ok])
+		default:
+			fmt.Fprintf(c, "-ERR unknown command '%s'\r\n", args[0])
+		}
+	}
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if exp, ok := f.expires[key]; ok && !time.Now().Before(exp) {
+		delete(f.data, key)
+		delete(f.expires, key)
+	}
+	v, ok := f.data[key]
+	return v, ok
+}
+
+func (f *fakeRedis) commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.cmds...)
+}
+
+func (f *fakeRedis) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for k := range f.data {
+		out = append(out, k)
+	}
+	return out
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = rd.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+type entry struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestRedis_SetGetDelete(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	c, err := cache.NewRedis[entry](srv.url(), "test:")
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+
+	_, ok := c.Get(ctx, "k")
+	require.False(t, ok)
+
+	c.Set(ctx, "k", entry{Name: "a\r\nb", Count: 3}, time.Minute)
+	require.Equal(t, []string{"test:k"}, srv.keys())
+	got, ok := c.Get(ctx, "k")
+	require.True(t, ok)
+	require.Equal(t, entry{Name: "a\r\nb", Count: 3}, got)
+
+	c.Delete(ctx, "k")
+	_, ok = c.Get(ctx, "k")
+	require.False(t, ok)
+
+	st := c.Stats()
+	require.EqualValues(t, 1, st.Hits)
+	require.EqualValues(t, 2, st.Misses)
+	require.Zero(t, st.Errors)
+}
+
+func TestRedis_TTL(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	c, err := cache.NewRedis[entry](srv.url(), "")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	c.Set(ctx, "k", entry{Name: "x"}, 20*time.Millisecond)
+	_, ok := c.Get(ctx, "k")
+	require.True(t, ok)
+	time.Sleep(40 * time.Millisecond)
+	_, ok = c.Get(ctx, "k")
+	require.False(t, ok)
+}
+
+func TestRedis_AuthAndSelect(t *testing.T) {
+	srv := newFakeRedis(t, "s3cret")
+	c, err := cache.NewRedis[entry](srv.url(), "")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	c.Set(ctx, "k", entry{Name: "x"}, time.Minute)
+	_, ok := c.Get(ctx, "k")
+	require.True(t, ok)
+	require.Equal(t, []string{"AUTH", "SELECT", "SET", "GET"}, srv.commands()) // one pooled connection
+
+	bad, err := cache.NewRedis[entry]("redis://:wrong@"+srv.ln.Addr().String(), "")
+	require.NoError(t, err)
+	_, ok = bad.Get(ctx, "k")
+	require.False(t, ok)
+	require.EqualValues(t, 1, bad.Stats().Errors)
+}
+
+func TestRedis_DownReadsAsMiss(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c, err := cache.NewRedis[entry]("redis://"+addr, "")
+	require.NoError(t, err)
+	c.Set(context.Background(), "k", entry{}, time.Minute)
+	_, ok := c.Get(context.Background(), "k")
+	require.False(t, ok)
+	require.EqualValues(t, 2, c.Stats().Errors)
+}
+
+func TestNewRedisRejectsBadURL(t *testing.T) {
+	for _, u := range []string{"localhost:6379", "http://localhost", "redis://localhost/x"} {
+		_, err := cache.NewRedis[entry](u, "")
+		require.Error(t, err, u)
+	}
+}
+
+type countingProvider struct{ calls atomic.Int32 }
+
+func (p *countingProvider) Name() string { return "counting" }
+
+func (p *countingProvider) Search(context.Context, providers.SearchRequest) ([]providers.FlightOffer, error) {
+	p.calls.Add(1)
+	return []providers.FlightOffer{{Provider: "counting", Price: money.New(12345, "EUR"), DurationMin: 90}}, nil
+}
+
+func TestRedis_SharedBetweenReplicas(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	p := &countingProvider{}
+	replica := func() *service.SearchService {
+		c, err := cache.NewRedis[service.CacheEntry](srv.url(), "flights:")
+		require.NoError(t, err)
+		return service.NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute, service.WithCache(c))
+	}
+	a, b := replica(), replica()
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+
+	resA, err := a.Search(context.Background(), req)
+	require.NoError(t, err)
+	resB, err := b.Search(context.Background(), req)
+	require.NoError(t, err)
+
+	require.EqualValues(t, 1, p.calls.Load())
+	require.Equal(t, resA.Cheapest.Price, resB.Cheapest.Price)
+	require.Equal(t, resA.Providers, resB.Providers)
+}
@@ -1,19 +1,44 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
+// RateLimit bounds the outbound calls made to one provider. Zero fields
+// mean no limit.
+type RateLimit struct {
+	RPS     float64 `mapstructure:"rps"`
+	Burst   int     `mapstructure:"burst"`
+	Daily   int     `mapstructure:"daily"`
+	Monthly int     `mapstructure:"monthly"`
+}
+
 type Config struct {
 	JWTSecret               string
 	JWTUser                 string
 	JWTPassword             string
 	SearchTimeout           time.Duration
 	CacheTTL                time.Duration
+	CacheStale              time.Duration
+	CacheNegativeTTL        time.Duration
+	CacheMaxEntries         int
+	CacheMaxBytes           int64
+	RedisURL                string
+	RetryAttempts           int
+	RetryBaseDelay          time.Duration
+	BreakerThreshold        int
+	BreakerCooldown         time.Duration
+	ProviderTimeouts        map[string]time.Duration
+	HedgePercentile         float64
+	RateLimits              map[string]RateLimit
+	StreamInterval          time.Duration
 	TLSCertFile             string
 	TLSKeyFile              string
 	AmadeusURL              string
@@ -23,6 +48,9 @@ type Config struct {
 	DuffelToken             string
 	RapidBookingHost        string
 	RapidBookingRapidApiKey string
+	FXRatesFile             string
+	FXRatesURL              string
+	FXRefresh               time.Duration
 }
 
 func Load() *Config {
@@ -32,10 +60,20 @@ func Load() *Config {
 	v.SetDefault("auth_pass", "demo123")
 	v.SetDefault("search_timeout", "10s")
 	v.SetDefault("cache_ttl", "30s")
+	v.SetDefault("cache_stale", "1m")
+	v.SetDefault("cache_negative_ttl", "5s")
+	v.SetDefault("cache_max_entries", 10000)
+	v.SetDefault("cache_max_mb", 0)
 
 	v.SetDefault("amadeus_url", "https://test.api.amadeus.com")
 	v.SetDefault("duffel_host", "https://api.duffel.com")
 	v.SetDefault("rapid_booking_host", "booking-com15.p.rapidapi.com")
+	v.SetDefault("fx_refresh", "1h")
+	v.SetDefault("retry_attempts", 3)
+	v.SetDefault("retry_base_delay", "200ms")
+	v.SetDefault("breaker_threshold", 5)
+	v.SetDefault("breaker_cooldown", "30s")
+	v.SetDefault("stream_interval", "30s")
 
 	if path := os.Getenv("FLIGHTS_CONFIG"); path != "" {
 		v.SetConfigFile(path)
@@ -62,12 +100,62 @@ func Load() *Config {
 		log.Fatalf("bad cache_ttl: %v", err)
 	}
 
+	stale, err := time.ParseDuration(v.GetString("cache_stale"))
+	if err != nil {
+		log.Fatalf("bad cache_stale: %v", err)
+	}
+	neg, err := time.ParseDuration(v.GetString("cache_negative_ttl"))
+	if err != nil {
+		log.Fatalf("bad cache_negative_ttl: %v", err)
+	}
+
+	fxr, err := time.ParseDuration(v.GetString("fx_refresh"))
+	if err != nil {
+		log.Fatalf("bad fx_refresh: %v", err)
+	}
+
+	rbd, err := time.ParseDuration(v.GetString("retry_base_delay"))
+	if err != nil {
+		log.Fatalf("bad retry_base_delay: %v", err)
+	}
+	bc, err := time.ParseDuration(v.GetString("breaker_cooldown"))
+	if err != nil {
+		log.Fatalf("bad breaker_cooldown: %v", err)
+	}
+
+	si, err := time.ParseDuration(v.GetString("stream_interval"))
+	if err != nil {
+		log.Fatalf("bad stream_interval: %v", err)
+	}
+
+	pt, err := providerTimeouts(v)
+	if err != nil {
+		log.Fatalf("bad provider_timeouts: %v", err)
+	}
+	rl, err := rateLimits(v)
+	if err != nil {
+		log.Fatalf("bad rate_limits: %v", err)
+	}
+
 	return &Config{
 		JWTSecret:               v.GetString("jwt_secret"),
 		JWTUser:                 v.GetString("auth_user"),
 		JWTPassword:             v.GetString("auth_pass"),
 		SearchTimeout:           to,
 		CacheTTL:                ct,
+		CacheStale:              stale,
+		CacheNegativeTTL:        neg,
+		CacheMaxEntries:         v.GetInt("cache_max_entries"),
+		CacheMaxBytes:           v.GetInt64("cache_max_mb") << 20,
+		RedisURL:                v.GetString("redis_url"),
+		RetryAttempts:           v.GetInt("retry_attempts"),
+		RetryBaseDelay:          rbd,
+		BreakerThreshold:        v.GetInt("breaker_threshold"),
+		BreakerCooldown:         bc,
+		ProviderTimeouts:        pt,
+		HedgePercentile:         v.GetFloat64("hedge_percentile"),
+		RateLimits:              rl,
+		StreamInterval:          si,
 		TLSCertFile:             os.Getenv("TLS_CERT_FILE"),
 		TLSKeyFile:              os.Getenv("TLS_KEY_FILE"),
 		AmadeusURL:              v.GetString("amadeus_url"),
@@ -77,5 +165,82 @@ func Load() *Config {
 		DuffelToken:             v.GetString("duffel_token"),
 		RapidBookingHost:        v.GetString("rapid_booking_host"),
 		RapidBookingRapidApiKey: v.GetString("rapid_booking_rapidapikey"),
+		FXRatesFile:             v.GetString("fx_rates_file"),
+		FXRatesURL:              v.GetString("fx_rates_url"),
+		FXRefresh:               fxr,
+	}
+}
+
+// providerTimeouts reads per-provider timeouts either as a YAML map
+// (provider_timeouts: {amadeus: 3s}) or, from the environment, as
+// PROVIDER_TIMEOUTS=amadeus=3s,duffel=5s.
+func providerTimeouts(v *viper.Viper) (map[string]time.Duration, error) {
+	raw := v.GetStringMapString("provider_timeouts")
+	if len(raw) == 0 {
+		raw = map[string]string{}
+		for _, kv := range strings.Split(v.GetString("provider_timeouts"), ",") {
+			name, d, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if ok {
+				raw[strings.TrimSpace(name)] = strings.TrimSpace(d)
+			}
+		}
+	}
+	out := make(map[string]time.Duration, len(raw))
+	for name, d := range raw {
+		dur, err := time.ParseDuration(d)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		out[strings.ToLower(name)] = dur
+	}
+	return out, nil
+}
+
+// rateLimits reads per-provider limits either as a YAML map
+// (rate_limits: {amadeus: {rps: 10, burst: 10, monthly: 2000}}) or, from
+// the environment, as RATE_LIMITS=amadeus:rps=10:monthly=2000,duffel:rps=5.
+func rateLimits(v *viper.Viper) (map[string]RateLimit, error) {
+	out := map[string]RateLimit{}
+	if v.IsSet("rate_limits") && len(v.GetStringMap("rate_limits")) > 0 {
+		if err := v.UnmarshalKey("rate_limits", &out); err != nil {
+			return nil, err
+		}
+		return lowerKeys(out), nil
+	}
+	for _, entry := range strings.Split(v.GetString("rate_limits"), ",") {
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if fields[0] == "" {
+			continue
+		}
+		var rl RateLimit
+		for _, kv := range fields[1:] {
+			k, val, _ := strings.Cut(kv, "=")
+			var err error
+			switch strings.TrimSpace(k) {
+			case "rps":
+				rl.RPS, err = strconv.ParseFloat(val, 64)
+			case "burst":
+				rl.Burst, err = strconv.Atoi(val)
+			case "daily":
+				rl.Daily, err = strconv.Atoi(val)
+			case "monthly":
+				rl.Monthly, err = strconv.Atoi(val)
+			default:
+				err = fmt.Errorf("unknown field %q", k)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fields[0], err)
+			}
+		}
+		out[fields[0]] = rl
+	}
+	return lowerKeys(out), nil
+}
+
+func lowerKeys(m map[string]RateLimit) map[string]RateLimit {
+	out := make(map[string]RateLimit, len(m))
+	for k, v := range m {
+		out[strings.ToLower(strings.TrimSpace(k))] = v
 	}
+	return out
 }
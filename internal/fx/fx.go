@@ -0,0 +1,212 @@
+// Package fx converts amounts between currencies using exchange rates from a
+// pluggable RateSource.
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/money"
+	"golang.org/x/sync/singleflight"
+)
+
+// Rates quotes every currency against Base: 1 Base = Rates[c] units of c.
+type Rates struct {
+	Base  string             `json:"base"`
+	Date  string             `json:"date,omitempty"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// rate returns the quote for currency as an exact decimal (the shortest
+// representation of the float, so 1.08 is 108/100 rather than its binary
+// approximation).
+func (r Rates) rate(currency string) (*big.Rat, bool) {
+	if strings.EqualFold(currency, r.Base) {
+		return big.NewRat(1, 1), true
+	}
+	v, ok := r.Rates[strings.ToUpper(currency)]
+	if !ok || v <= 0 {
+		return nil, false
+	}
+	q, ok := new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+	return q, ok
+}
+
+type RateSource interface {
+	Rates(ctx context.Context) (Rates, error)
+}
+
+// FileSource reads rates from a JSON file ({"base":"EUR","rates":{"USD":1.08}}),
+// re-reading it on every refresh so the file can be updated in place.
+type FileSource struct {
+	Path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{Path: path}
+}
+
+func (f *FileSource) Rates(ctx context.Context) (Rates, error) {
+	b, err := os.ReadFile(f.Path)
+	if err != nil {
+		return Rates{}, err
+	}
+	return decodeRates(b)
+}
+
+// HTTPSource fetches rates from an endpoint speaking the same JSON shape,
+// e.g. https://api.frankfurter.app/latest?from=EUR.
+type HTTPSource struct {
+	URL    string
+	client *http.Client
+}
+
+func NewHTTPSource(url string) *HTTPSource {
+	return &HTTPSource{URL: url, client: http.DefaultClient}
+}
+
+func (h *HTTPSource) Rates(ctx context.Context) (Rates, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return Rates{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return Rates{}, fmt.Errorf("fx rates: %s", resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Rates{}, err
+	}
+	return decodeRates(b)
+}
+
+func decodeRates(b []byte) (Rates, error) {
+	var r Rates
+	if err := json.Unmarshal(b, &r); err != nil {
+		return Rates{}, err
+	}
+	if r.Base == "" || len(r.Rates) == 0 {
+		return Rates{}, errors.New("fx rates: base and rates are required")
+	}
+	r.Base = strings.ToUpper(r.Base)
+	return r, nil
+}
+
+// refreshTimeout bounds a refresh nobody waits for, so a hanging source
+// cannot hold up the next one.
+const refreshTimeout = 30 * time.Second
+
+// Converter caches the rates of a source and refreshes them once they are
+// older than the refresh interval. Only the very first load is waited for:
+// after that, stale rates keep being served while a single background
+// refresh replaces them, and a failed refresh keeps the previous rates.
+type Converter struct {
+	src     RateSource
+	refresh time.Duration
+	fetch   singleflight.Group
+
+	mu        sync.RWMutex
+	rates     Rates
+	fetchedAt time.Time
+}
+
+func NewConverter(src RateSource, refresh time.Duration) *Converter {
+	return &Converter{src: src, refresh: refresh}
+}
+
+// Refresh loads the latest rates from the source.
+func (c *Converter) Refresh(ctx context.Context) error {
+	r, err := c.src.Rates(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.rates, c.fetchedAt = r, time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the rates every interval until ctx is done. It returns at
+// once when the interval is not positive.
+func (c *Converter) Run(ctx context.Context) {
+	if c.refresh <= 0 {
+		return
+	}
+	t := time.NewTicker(c.refresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			_ = c.Refresh(ctx)
+		}
+	}
+}
+
+// refreshShared starts a refresh detached from any caller, or joins the
+// one already running.
+func (c *Converter) refreshShared() <-chan singleflight.Result {
+	return c.fetch.DoChan("rates", func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+		defer cancel()
+		return nil, c.Refresh(ctx)
+	})
+}
+
+func (c *Converter) current(ctx context.Context) (Rates, error) {
+	c.mu.RLock()
+	r, at := c.rates, c.fetchedAt
+	c.mu.RUnlock()
+	if at.IsZero() {
+		select {
+		case res := <-c.refreshShared():
+			if res.Err != nil {
+				return Rates{}, res.Err
+			}
+		case <-ctx.Done():
+			return Rates{}, ctx.Err()
+		}
+		c.mu.RLock()
+		r = c.rates
+		c.mu.RUnlock()
+		return r, nil
+	}
+	if c.refresh > 0 && time.Since(at) > c.refresh {
+		c.refreshShared() // served stale until it lands
+	}
+	return r, nil
+}
+
+// Convert turns m into the equivalent amount in currency to, rounded to
+// that currency's minor unit.
+func (c *Converter) Convert(ctx context.Context, m money.Money, to string) (money.Money, error) {
+	if strings.EqualFold(m.Currency, to) {
+		return m, nil
+	}
+	r, err := c.current(ctx)
+	if err != nil {
+		return money.Money{}, err
+	}
+	rf, ok := r.rate(m.Currency)
+	if !ok {
+		return money.Money{}, fmt.Errorf("fx: no rate for %s", m.Currency)
+	}
+	rt, ok := r.rate(to)
+	if !ok {
+		return money.Money{}, fmt.Errorf("fx: no rate for %s", strings.ToUpper(to))
+	}
+	return m.Convert(new(big.Rat).Quo(rt, rf), to), nil
+}
@@ -0,0 +1,118 @@
+package fx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/money"
+)
+
+func TestConverter_FileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"base":"eur","rates":{"USD":1.25,"GBP":0.8}}`), 0o600))
+
+	c := NewConverter(NewFileSource(path), time.Hour)
+	ctx := context.Background()
+
+	v, err := c.Convert(ctx, money.New(10000, "EUR"), "USD")
+	require.NoError(t, err)
+	require.Equal(t, money.New(12500, "USD"), v)
+
+	v, err = c.Convert(ctx, money.New(12500, "USD"), "GBP")
+	require.NoError(t, err)
+	require.Equal(t, money.New(8000, "GBP"), v)
+
+	v, err = c.Convert(ctx, money.New(42, "JPY"), "jpy")
+	require.NoError(t, err)
+	require.Equal(t, money.New(42, "JPY"), v)
+
+	_, err = c.Convert(ctx, money.New(1, "EUR"), "JPY")
+	require.EqualError(t, err, "fx: no rate for JPY")
+}
+
+func TestConverter_HTTPSourceRefresh(t *testing.T) {
+	var calls, fail int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&fail) == 1 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"amount":1.0,"base":"EUR","date":"2025-10-01","rates":{"USD":2}}`))
+	}))
+	defer srv.Close()
+
+	c := NewConverter(NewHTTPSource(srv.URL), 20*time.Millisecond)
+	ctx := context.Background()
+
+	ten := money.New(1000, "USD")
+	v, err := c.Convert(ctx, ten, "EUR")
+	require.NoError(t, err)
+	require.Equal(t, "5.00", v.String())
+	_, _ = c.Convert(ctx, ten, "EUR")
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls), "rates should be cached")
+
+	// once stale a failed refresh keeps serving the previous rates
+	atomic.StoreInt32(&fail, 1)
+	time.Sleep(30 * time.Millisecond)
+	v, err = c.Convert(ctx, ten, "EUR")
+	require.NoError(t, err)
+	require.Equal(t, "5.00", v.String())
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second, time.Millisecond)
+
+	empty := NewConverter(NewHTTPSource(srv.URL), time.Hour)
+	_, err = empty.Convert(ctx, ten, "EUR")
+	require.Error(t, err)
+}
+
+func TestConverter_StaleRatesDoNotWaitForTheSource(t *testing.T) {
+	var calls atomic.Int32
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > 1 {
+			<-hang
+		}
+		_, _ = w.Write([]byte(`{"base":"EUR","rates":{"USD":2}}`))
+	}))
+	defer srv.Close()
+	defer close(hang)
+
+	c := NewConverter(NewHTTPSource(srv.URL), time.Millisecond)
+	ctx := context.Background()
+	_, err := c.Convert(ctx, money.New(1000, "USD"), "EUR")
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	// the source now hangs: every conversion still answers from the cached
+	// rates, and only one refresh is in flight
+	start := time.Now()
+	for range 10 {
+		v, err := c.Convert(ctx, money.New(1000, "USD"), "EUR")
+		require.NoError(t, err)
+		require.Equal(t, "5.00", v.String())
+	}
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	require.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	require.EqualValues(t, 2, calls.Load())
+}
+
+func TestConverter_RunWithoutInterval(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		NewConverter(NewFileSource("rates.json"), 0).Run(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run should return when refreshing is disabled")
+	}
+}
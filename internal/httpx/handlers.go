@@ -2,49 +2,434 @@ package httpx
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/you/go-jobsity-flights/internal/airports"
+	"github.com/you/go-jobsity-flights/internal/money"
 	"github.com/you/go-jobsity-flights/internal/providers"
 	"github.com/you/go-jobsity-flights/internal/service"
 )
 
 type searchResponse struct {
-	Origin      string                  `json:"origin"`
-	Destination string                  `json:"destination"`
-	Date        string                  `json:"date"`
-	Cheapest    providers.FlightOffer   `json:"cheapest"`
-	Fastest     providers.FlightOffer   `json:"fastest"`
-	Offers      []providers.FlightOffer `json:"offers"`
+	Origin        string                   `json:"origin"`
+	Destination   string                   `json:"destination"`
+	Date          string                   `json:"date"`
+	Slices        []providers.Slice        `json:"slices"`
+	Passengers    providers.Passengers     `json:"passengers"`
+	Cabin         providers.CabinClass     `json:"cabin"`
+	Currency      string                   `json:"currency"`
+	Cheapest      providers.FlightOffer    `json:"cheapest"`
+	Fastest       providers.FlightOffer    `json:"fastest"`
+	Offers        []providers.FlightOffer  `json:"offers"`
+	Total         int                      `json:"total"`
+	SnapshotID    string                   `json:"snapshot_id,omitempty"`
+	NextCursor    string                   `json:"next_cursor,omitempty"`
+	Partial       bool                     `json:"partial"`
+	Providers     []service.ProviderStatus `json:"providers"`
+	SkippedRoutes []string                 `json:"skipped_routes,omitempty"`
 }
 
 func SearchHandler(svc *service.SearchService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit, err := parseLimit(q)
+		if err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+
+		// follow-up pages are served from the stored snapshot, never from providers
+		if c := q.Get("cursor"); c != "" {
+			id, offset, cursorLimit, err := service.DecodeCursor(c)
+			if err != nil {
+				writeBadRequest(w, err)
+				return
+			}
+			snap, err := svc.Snapshot(r.Context(), id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusGone)
+				return
+			}
+			if limit == 0 {
+				limit = cursorLimit
+			}
+			writeSearchResponse(w, snap.Request, snap.Result, snap.Page(offset, limit))
+			return
+		}
+
+		req, err := parseSearchRequest(q)
+		if err == nil {
+			err = validateRoute(req, svc.Airports(), time.Now())
+		}
+		if err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+		filter, err := parseFilter(q, req.Currency)
+		if err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+		if v := q.Get("stream"); v == "1" || v == "true" {
+			streamSearch(w, r, svc, req, filter, limit)
+			return
+		}
+		res, fresh, err := svc.SearchWithFreshness(r.Context(), req)
+		setFreshnessHeaders(w, fresh)
+		if err != nil {
+			writeSearchError(w, err, res.Providers)
+			return
+		}
+		res = filter.Apply(res)
+		page := service.Page{Offers: res.All, Total: len(res.All)}
+		if limit > 0 {
+			page = svc.SaveSnapshot(r.Context(), req, res).Page(0, limit)
+		}
+		writeSearchResponse(w, req, res, page)
+	}
+}
+
+func writeSearchResponse(w http.ResponseWriter, req providers.SearchRequest, res service.SearchResult, page service.Page) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newSearchResponse(req, res, page))
+}
+
+func newSearchResponse(req providers.SearchRequest, res service.SearchResult, page service.Page) searchResponse {
+	first := req.Slices[0]
+	return searchResponse{
+		Origin: first.Origin, Destination: first.Destination, Date: first.Date, Slices: req.Slices,
+		Passengers: req.Passengers, Cabin: req.Cabin, Currency: req.Currency,
+		Cheapest: res.Cheapest, Fastest: res.Fastest, Offers: page.Offers,
+		Total: page.Total, SnapshotID: page.SnapshotID, NextCursor: page.NextCursor,
+		Partial: res.Partial, Providers: res.Providers, SkippedRoutes: res.SkippedRoutes,
+	}
+}
+
+// setFreshnessHeaders tells clients how current a search result is:
+// Age in seconds, X-Cache-Source (providers or cache) and X-Cache-Stale
+// when an expired result was served while it is being refreshed.
+func setFreshnessHeaders(w http.ResponseWriter, fr service.Freshness) {
+	if fr.Source == "" {
+		return
+	}
+	h := w.Header()
+	h.Set("Age", strconv.Itoa(int(fr.Age.Seconds())))
+	h.Set("X-Cache-Source", fr.Source)
+	h.Set("X-Cache-Stale", strconv.FormatBool(fr.Stale))
+}
+
+// parseLimit reads the page size; 0 means no pagination.
+func parseLimit(q url.Values) (int, error) {
+	v := q.Get("limit")
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 || n > service.MaxPageSize {
+		return 0, fmt.Errorf("limit must be between 1 and %d", service.MaxPageSize)
+	}
+	return n, nil
+}
+
+// parseSearchRequest builds a search from either origin/destination/date
+// (plus an optional return_date for round trips) or repeated
+// slice=ORIGIN,DESTINATION,DATE parameters for multi-city journeys.
+func parseSearchRequest(q url.Values) (providers.SearchRequest, error) {
+	if raw := q["slice"]; len(raw) > 0 {
+		var req providers.SearchRequest
+		for _, s := range raw {
+			f := strings.Split(s, ",")
+			if len(f) != 3 {
+				return providers.SearchRequest{}, fmt.Errorf("bad slice %q, use slice=ORIGIN,DESTINATION,YYYY-MM-DD", s)
+			}
+			req.Slices = append(req.Slices, providers.Slice{
+				Origin:      strings.ToUpper(strings.TrimSpace(f[0])),
+				Destination: strings.ToUpper(strings.TrimSpace(f[1])),
+				Date:        strings.TrimSpace(f[2]),
+			})
+		}
+		return withSearchOptions(req, q)
+	}
+	return routeSearchRequest(q.Get("origin"), q.Get("destination"), q)
+}
+
+// routeSearchRequest builds a one-way or return search for a fixed route,
+// as used by the SSE and WS endpoints.
+func routeSearchRequest(origin, dest string, q url.Values) (providers.SearchRequest, error) {
+	origin, dest = strings.ToUpper(origin), strings.ToUpper(dest)
+	req := providers.OneWay(origin, dest, q.Get("date"))
+	if rd := q.Get("return_date"); rd != "" {
+		req = providers.RoundTrip(origin, dest, q.Get("date"), rd)
+	}
+	return withSearchOptions(req, q)
+}
+
+// withSearchOptions reads the passenger mix (adults, children, infants),
+// nearby_km, cabin and currency parameters shared by all search endpoints, then
+// validates the complete request.
+func withSearchOptions(req providers.SearchRequest, q url.Values) (providers.SearchRequest, error) {
+	req.Passengers = providers.Passengers{Adults: 1}
+	counts := []struct {
+		name string
+		dst  *int
+	}{
+		{"adults", &req.Passengers.Adults},
+		{"children", &req.Passengers.Children},
+		{"infants", &req.Passengers.Infants},
+	}
+	for _, c := range counts {
+		v := q.Get(c.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return providers.SearchRequest{}, fmt.Errorf("bad %s %q", c.name, v)
+		}
+		*c.dst = n
+	}
+	if v := q.Get("nearby_km"); v != "" {
+		km, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return providers.SearchRequest{}, fmt.Errorf("bad nearby_km %q", v)
+		}
+		req.NearbyKm = km
+	}
+	req.Cabin = providers.CabinClass(strings.ToLower(q.Get("cabin")))
+	req.Currency = q.Get("currency")
+	req = req.WithDefaults()
+	return req, req.Validate()
+}
+
+// parseFilter reads the optional filter and sort parameters:
+// max_price (in the search currency), max_stops, max_duration (minutes), depart_window and
+// arrive_window (HH:MM-HH:MM), carriers, exclude_carriers, providers,
+// exclude_providers (comma separated) and sort.
+func parseFilter(q url.Values, currency string) (service.Filter, error) {
+	var f service.Filter
+	if v := q.Get("max_price"); v != "" {
+		p, err := money.Parse(v, currency)
+		if err != nil {
+			return f, fmt.Errorf("bad max_price %q", v)
+		}
+		f.MaxPrice = &p
+	}
+	if v := q.Get("max_stops"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("bad max_stops %q", v)
+		}
+		f.MaxStops = &n
+	}
+	if v := q.Get("max_duration"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("bad max_duration %q", v)
+		}
+		f.MaxDurationMin = n
+	}
+	var err error
+	if v := q.Get("depart_window"); v != "" {
+		if f.DepartWindow, err = service.ParseTimeWindow(v); err != nil {
+			return f, err
+		}
+	}
+	if v := q.Get("arrive_window"); v != "" {
+		if f.ArriveWindow, err = service.ParseTimeWindow(v); err != nil {
+			return f, err
+		}
+	}
+	f.Carriers = splitList(q.Get("carriers"))
+	f.ExcludeCarriers = splitList(q.Get("exclude_carriers"))
+	f.Providers = splitList(q.Get("providers"))
+	f.ExcludeProviders = splitList(q.Get("exclude_providers"))
+	f.Sort = service.SortBy(strings.ToLower(q.Get("sort")))
+	return f, f.Validate()
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// errorResponse is returned for rejected requests and (also pushed to SSE/WS
+// subscribers) when a search yields no offers at all.
+type errorResponse struct {
+	Error     string                   `json:"error"`
+	Fields    []FieldError             `json:"fields,omitempty"`
+	Providers []service.ProviderStatus `json:"providers,omitempty"`
+}
+
+// writeSearchError reports a failed search as 502, keeping the per-provider
+// breakdown so clients can tell which upstream was unavailable.
+func writeSearchError(w http.ResponseWriter, err error, statuses []service.ProviderStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: err.Error(), Providers: statuses})
+}
+
+type calendarResponse struct {
+	Origin      string               `json:"origin"`
+	Destination string               `json:"destination"`
+	Passengers  providers.Passengers `json:"passengers"`
+	Cabin       providers.CabinClass `json:"cabin"`
+	Currency    string               `json:"currency"`
+	service.Calendar
+}
+
+const (
+	defaultCalendarDays = 3
+	maxCalendarDays     = 15
+)
+
+// CalendarHandler serves the cheapest and fastest offer per day around a
+// date (date=YYYY-MM-DD&days=N, default ±3) or across a month
+// (month=YYYY-MM). Adding return_date (and optionally return_days) turns
+// it into an outbound by return matrix.
+func CalendarHandler(svc *service.SearchService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
 		origin := strings.ToUpper(q.Get("origin"))
 		dest := strings.ToUpper(q.Get("destination"))
-		date := q.Get("date")
-		if origin == "" || dest == "" || date == "" {
-			http.Error(w, "origin, destination and date are required", http.StatusBadRequest)
+		if origin == "" || dest == "" {
+			writeBadRequest(w, errors.New("origin and destination are required"))
 			return
 		}
-		res, err := svc.Search(r.Context(), origin, dest, date)
+		days, err := parseCalendarDays(q, "days", defaultCalendarDays)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadGateway)
+			writeBadRequest(w, err)
+			return
+		}
+
+		var dates []string
+		switch {
+		case q.Get("month") != "":
+			dates, err = service.MonthDates(q.Get("month"))
+		case q.Get("date") != "":
+			dates, err = service.DateWindow(q.Get("date"), days)
+		default:
+			err = errors.New("date or month is required")
+		}
+		if err == nil && len(dates) == 0 {
+			err = errors.New("no upcoming dates in the requested window")
+		}
+		if err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+
+		var returnDates []string
+		if rd := q.Get("return_date"); rd != "" {
+			returnDays, err := parseCalendarDays(q, "return_days", days)
+			if err != nil {
+				writeBadRequest(w, err)
+				return
+			}
+			if returnDates, err = service.DateWindow(rd, returnDays); err != nil {
+				writeBadRequest(w, err)
+				return
+			}
+		}
+
+		base, err := withSearchOptions(providers.OneWay(origin, dest, dates[0]), q)
+		if err == nil {
+			err = validateRoute(base, svc.Airports(), time.Now())
+		}
+		if err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+		cal, err := svc.Calendar(r.Context(), base, dates, returnDates, service.DefaultCalendarConcurrency)
+		if err != nil {
+			writeBadRequest(w, err)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(searchResponse{
-			Origin: origin, Destination: dest, Date: date,
-			Cheapest: res.Cheapest, Fastest: res.Fastest, Offers: res.All,
+		_ = json.NewEncoder(w).Encode(calendarResponse{
+			Origin: origin, Destination: dest,
+			Passengers: base.Passengers, Cabin: base.Cabin, Currency: base.Currency,
+			Calendar: cal,
 		})
 	}
 }
 
+func parseCalendarDays(q url.Values, name string, def int) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > maxCalendarDays {
+		return 0, fmt.Errorf("%s must be between 0 and %d", name, maxCalendarDays)
+	}
+	return n, nil
+}
+
+const (
+	defaultAirportResults = 10
+	maxAirportResults     = 50
+)
+
+// AirportsHandler serves airport autocomplete: /airports?q=lon[&limit=10]
+// matches codes, city codes, names and cities.
+func AirportsHandler(db *airports.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if strings.TrimSpace(q.Get("q")) == "" {
+			writeBadRequest(w, errors.New("q is required"))
+			return
+		}
+		limit := defaultAirportResults
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > maxAirportResults {
+				writeBadRequest(w, fmt.Errorf("limit must be between 1 and %d", maxAirportResults))
+				return
+			}
+			limit = n
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(db.Search(q.Get("q"), limit))
+	}
+}
+
+// CacheStatsHandler reports the search cache hit, miss and eviction counters.
+func CacheStatsHandler(svc *service.SearchService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(svc.CacheStats())
+	}
+}
+
+// BreakersHandler reports each provider's circuit breaker state.
+func BreakersHandler(svc *service.SearchService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(svc.Breakers())
+	}
+}
+
+// QuotasHandler reports each provider's rate limit and quota usage.
+func QuotasHandler(svc *service.SearchService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(svc.Quotas())
+	}
+}
+
 func HistoryHandler(hist *service.HistoryService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		q := r.URL.Query()
@@ -60,18 +445,36 @@ func HistoryHandler(hist *service.HistoryService) http.HandlerFunc {
 	}
 }
 
-func SubscribeSSEHandler(svc *service.SearchService) http.HandlerFunc {
+// SSE connection hints: how soon EventSource should reconnect, and how
+// often an idle stream sends a comment so proxies keep it open.
+var (
+	sseRetry     = 3 * time.Second
+	sseKeepAlive = 15 * time.Second
+)
+
+// SubscribeSSEHandler streams a route as Server-Sent Events: a snapshot
+// event, then delta or heartbeat events (see service.Change). Every event
+// has an id; a client reconnecting with Last-Event-ID within the resume
+// window gets the events it missed replayed, then the stream carries on.
+// Clients following the same search share one poller through the hub.
+func SubscribeSSEHandler(svc *service.SearchService, hub *service.Hub, sessions *service.StreamSessions) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/sse/"), "/")
 		if len(parts) < 2 {
-			http.Error(w, "use /sse/{origin}/{destination}?date=YYYY-MM-DD", 400)
+			writeBadRequest(w, errors.New("use /sse/{origin}/{destination}?date=YYYY-MM-DD[&return_date=YYYY-MM-DD]"))
+			return
+		}
+		req, err := routeSearchRequest(parts[0], parts[1], r.URL.Query())
+		if err == nil {
+			err = validateRoute(req, svc.Airports(), time.Now())
+		}
+		if err != nil {
+			writeBadRequest(w, err)
 			return
 		}
-		origin := strings.ToUpper(parts[0])
-		dest := strings.ToUpper(parts[1])
-		date := r.URL.Query().Get("date")
-		if date == "" {
-			http.Error(w, "date required", 400)
+		filter, err := parseFilter(r.URL.Query(), req.Currency)
+		if err != nil {
+			writeBadRequest(w, err)
 			return
 		}
 
@@ -84,8 +487,22 @@ func SubscribeSSEHandler(svc *service.SearchService) http.HandlerFunc {
 			return
 		}
 
-		updateTick := time.NewTicker(30 * time.Second)
-		defer updateTick.Stop()
+		sess, replay := sessions.Open(req.Key(), r.Header.Get("Last-Event-ID"))
+		defer sessions.Release(sess)
+		send := func(c service.Change) {
+			payload, _ := json.Marshal(c)
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", sess.EventID(c), c.Type, payload)
+		}
+		fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+		for _, c := range replay {
+			send(c)
+		}
+		flusher.Flush()
+
+		sub := hub.Subscribe(req)
+		defer sub.Close()
+		keepAlive := time.NewTicker(sseKeepAlive)
+		defer keepAlive.Stop()
 
 		ctx := r.Context()
 		for {
@@ -94,16 +511,27 @@ func SubscribeSSEHandler(svc *service.SearchService) http.HandlerFunc {
 				log.Println("SSE client closed")
 				return
 
-			case <-updateTick.C:
-				res, err := svc.Search(ctx, origin, dest, date)
-				if err != nil {
-					fmt.Fprintf(w, "event: error\ndata: %q\n\n", err.Error())
+			case <-sess.Taken():
+				log.Println("SSE stream resumed on another connection")
+				return
+
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+
+			case u := <-sub.C:
+				if u.Err != nil {
+					payload, _ := json.Marshal(errorResponse{Error: u.Err.Error(), Providers: u.Result.Providers})
+					fmt.Fprintf(w, "event: error\ndata: %s\n\n", payload)
 					flusher.Flush()
 					// decide if you want to continue or end; returning ends the stream
 					return
 				}
-				payload, _ := json.Marshal(res)
-				fmt.Fprintf(w, "event: update\ndata: %s\n\n", payload)
+				c, ok := sess.Next(filter.Apply(u.Result))
+				if !ok {
+					return
+				}
+				send(c)
 				flusher.Flush()
 			}
 		}
@@ -116,18 +544,26 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-func SubscribeWSHandler(svc *service.SearchService) http.HandlerFunc {
+// SubscribeWSHandler streams a route over a WebSocket, sharing the hub's
+// poller with every other subscriber of the same search.
+func SubscribeWSHandler(svc *service.SearchService, hub *service.Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/ws/"), "/")
 		if len(parts) < 2 {
-			http.Error(w, "use /ws/{origin}/{destination}?date=YYYY-MM-DD", 400)
+			writeBadRequest(w, errors.New("use /ws/{origin}/{destination}?date=YYYY-MM-DD[&return_date=YYYY-MM-DD]"))
 			return
 		}
-		origin := strings.ToUpper(parts[0])
-		dest := strings.ToUpper(parts[1])
-		date := r.URL.Query().Get("date")
-		if date == "" {
-			http.Error(w, "date required", 400)
+		req, err := routeSearchRequest(parts[0], parts[1], r.URL.Query())
+		if err == nil {
+			err = validateRoute(req, svc.Airports(), time.Now())
+		}
+		if err != nil {
+			writeBadRequest(w, err)
+			return
+		}
+		filter, err := parseFilter(r.URL.Query(), req.Currency)
+		if err != nil {
+			writeBadRequest(w, err)
 			return
 		}
 
@@ -138,26 +574,38 @@ func SubscribeWSHandler(svc *service.SearchService) http.HandlerFunc {
 		}
 		defer conn.Close()
 
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
+		// a hijacked connection's request context never ends, so watch for
+		// the client going away by reading until the socket fails
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		sub := hub.Subscribe(req)
+		defer sub.Close()
+		var diff service.Differ
 
 		ctx := r.Context()
 		for {
-			res, err := svc.Search(ctx, origin, dest, date)
-			if err != nil {
-				conn.WriteJSON(map[string]string{"error": err.Error()})
-				return
-			}
-			if err := conn.WriteJSON(res); err != nil {
-				log.Printf("write error: %v", err)
-				return
-			}
-
 			select {
 			case <-ctx.Done():
 				return
-			case <-ticker.C:
-				continue
+			case <-gone:
+				return
+			case u := <-sub.C:
+				if u.Err != nil {
+					conn.WriteJSON(errorResponse{Error: u.Err.Error(), Providers: u.Result.Providers})
+					return
+				}
+				if err := conn.WriteJSON(diff.Next(filter.Apply(u.Result))); err != nil {
+					log.Printf("write error: %v", err)
+					return
+				}
 			}
 		}
 	}
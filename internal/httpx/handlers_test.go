@@ -0,0 +1,197 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/money"
+	"github.com/you/go-jobsity-flights/internal/providers"
+	"github.com/you/go-jobsity-flights/internal/service"
+)
+
+func TestSearchHandlerFreshnessHeaders(t *testing.T) {
+	svc := service.NewSearchService([]providers.FlightProvider{staticProvider{}}, time.Second, time.Minute)
+	url := "/flights/search?origin=AMS&destination=BCN&date=" + time.Now().AddDate(0, 0, 7).Format(time.DateOnly)
+
+	rec := httptest.NewRecorder()
+	SearchHandler(svc)(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "providers", rec.Header().Get("X-Cache-Source"))
+	require.Equal(t, "false", rec.Header().Get("X-Cache-Stale"))
+	require.Equal(t, "0", rec.Header().Get("Age"))
+
+	rec = httptest.NewRecorder()
+	SearchHandler(svc)(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, "cache", rec.Header().Get("X-Cache-Source"))
+}
+
+type staticProvider struct{}
+
+func (staticProvider) Name() string { return "static" }
+
+func (staticProvider) Search(context.Context, providers.SearchRequest) ([]providers.FlightOffer, error) {
+	return []providers.FlightOffer{{Provider: "static", Price: money.New(10000, "EUR"), DurationMin: 60}}, nil
+}
+
+func TestSearchHandlerStream(t *testing.T) {
+	svc := service.NewSearchService([]providers.FlightProvider{staticProvider{}}, time.Second, time.Minute)
+	url := "/flights/search?stream=1&origin=AMS&destination=BCN&date=" + time.Now().AddDate(0, 0, 7).Format(time.DateOnly)
+
+	rec := httptest.NewRecorder()
+	SearchHandler(svc)(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	require.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	require.Contains(t, body, "event: provider\ndata: {\"provider\":\"static\",\"status\":\"ok\"")
+	require.Contains(t, body, "\"offers\":1,")
+	require.Contains(t, body, "\"results\":[{")
+	require.Contains(t, body, "event: summary\ndata: ")
+	require.Less(t, strings.Index(body, "event: provider"), strings.Index(body, "event: summary"))
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, url+"&max_price=50", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	SearchHandler(svc)(rec, req)
+	require.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	var last struct {
+		Event string         `json:"event"`
+		Data  searchResponse `json:"data"`
+	}
+	dec := json.NewDecoder(rec.Body)
+	for dec.More() {
+		require.NoError(t, dec.Decode(&last))
+	}
+	require.Equal(t, "summary", last.Event, "served from cache: only the summary")
+	require.Zero(t, last.Data.Total, "filters apply to the stream")
+}
+
+func TestSubscribeSSEHandlerSharesHub(t *testing.T) {
+	svc := service.NewSearchService([]providers.FlightProvider{staticProvider{}}, time.Second, time.Minute)
+	hub := service.NewHub(svc, time.Hour)
+	srv := httptest.NewServer(SubscribeSSEHandler(svc, hub, service.NewStreamSessions(0, time.Minute)))
+	defer srv.Close()
+	url := srv.URL + "/sse/AMS/BCN?date=" + time.Now().AddDate(0, 0, 7).Format(time.DateOnly)
+
+	for range 2 {
+		func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			events := readSSE(t, bufio.NewReader(resp.Body), 2)
+			require.Equal(t, "snapshot", events[1].event, "the first result arrives without waiting for a tick")
+		}()
+	}
+}
+
+type sseEvent struct {
+	id, event, data string
+	retry           string
+	comment         bool
+}
+
+// readSSE reads the next n SSE blocks: events, retry hints and comments.
+func readSSE(t *testing.T, rd *bufio.Reader, n int) []sseEvent {
+	t.Helper()
+	var out []sseEvent
+	var cur sseEvent
+	for len(out) < n {
+		line, err := rd.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			out = append(out, cur)
+			cur = sseEvent{}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			cur.comment = true
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			cur.id = value
+		case "event":
+			cur.event = value
+		case "data":
+			cur.data = value
+		case "retry":
+			cur.retry = value
+		}
+	}
+	return out
+}
+
+func openSSE(t *testing.T, url, lastEventID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		cancel()
+		resp.Body.Close()
+	})
+	return bufio.NewReader(resp.Body)
+}
+
+func TestSubscribeSSEHandlerResumes(t *testing.T) {
+	svc := service.NewSearchService([]providers.FlightProvider{staticProvider{}}, time.Second, time.Minute)
+	hub := service.NewHub(svc, 10*time.Millisecond)
+	srv := httptest.NewServer(SubscribeSSEHandler(svc, hub, service.NewStreamSessions(0, time.Minute)))
+	t.Cleanup(srv.Close) // after the streams opened below are closed
+	url := srv.URL + "/sse/AMS/BCN?date=" + time.Now().AddDate(0, 0, 7).Format(time.DateOnly)
+
+	firstConn := openSSE(t, url, "")
+	first := readSSE(t, firstConn, 4)
+	require.Equal(t, "3000", first[0].retry)
+	require.Equal(t, "snapshot", first[1].event)
+	require.Equal(t, "heartbeat", first[2].event)
+	session, seq, err := service.ParseEventID(first[1].id)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, seq)
+	require.Equal(t, session+":3", first[3].id)
+
+	// reconnect having only seen the snapshot: the rest is replayed
+	resumed := readSSE(t, openSSE(t, url, first[1].id), 4)
+	require.Equal(t, first[2].id, resumed[1].id)
+	require.Equal(t, first[3].id, resumed[2].id)
+	require.Equal(t, session+":4", resumed[3].id, "the sequence carries on")
+	require.Equal(t, "heartbeat", resumed[3].event)
+	_, err = io.ReadAll(firstConn)
+	require.NoError(t, err, "the stream moved: the old connection is closed")
+
+	// an unknown stream starts over
+	fresh := readSSE(t, openSSE(t, url, "gone:7"), 2)
+	require.Equal(t, "snapshot", fresh[1].event)
+	require.NotContains(t, fresh[1].id, session)
+}
+
+func TestSubscribeSSEHandlerKeepAlive(t *testing.T) {
+	old := sseKeepAlive
+	sseKeepAlive = 10 * time.Millisecond
+	t.Cleanup(func() { sseKeepAlive = old })
+
+	svc := service.NewSearchService([]providers.FlightProvider{staticProvider{}}, time.Second, time.Minute)
+	hub := service.NewHub(svc, time.Hour)
+	srv := httptest.NewServer(SubscribeSSEHandler(svc, hub, service.NewStreamSessions(0, time.Minute)))
+	t.Cleanup(srv.Close)
+
+	events := readSSE(t, openSSE(t, srv.URL+"/sse/AMS/BCN?date="+time.Now().AddDate(0, 0, 7).Format(time.DateOnly), ""), 4)
+	require.Equal(t, "snapshot", events[1].event)
+	require.True(t, events[2].comment)
+	require.True(t, events[3].comment)
+}
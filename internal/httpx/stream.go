@@ -0,0 +1,95 @@
+package httpx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/you/go-jobsity-flights/internal/providers"
+	"github.com/you/go-jobsity-flights/internal/service"
+)
+
+// eventWriter sends named JSON events to a streaming client.
+type eventWriter interface {
+	event(name string, v any) error
+}
+
+// sseWriter writes Server-Sent Events.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s sseWriter) event(name string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// ndjsonWriter writes one {"event": ..., "data": ...} object per line.
+type ndjsonWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (n ndjsonWriter) event(name string, v any) error {
+	err := json.NewEncoder(n.w).Encode(struct {
+		Event string `json:"event"`
+		Data  any    `json:"data"`
+	}{name, v})
+	if err != nil {
+		return err
+	}
+	n.flusher.Flush()
+	return nil
+}
+
+// newEventWriter starts a streamed response: NDJSON when the client asks
+// for application/x-ndjson (or format=ndjson), SSE otherwise.
+func newEventWriter(w http.ResponseWriter, r *http.Request) (eventWriter, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.URL.Query().Get("format") == "ndjson" || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		return ndjsonWriter{w: w, flusher: flusher}, true
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Connection", "keep-alive")
+	return sseWriter{w: w, flusher: flusher}, true
+}
+
+// streamSearch answers /flights/search?stream=1: a "provider" event with
+// each provider's (filtered) offers as soon as it answers, then a
+// "summary" event carrying the usual search response, or an "error" event
+// when nothing was found.
+func streamSearch(w http.ResponseWriter, r *http.Request, svc *service.SearchService, req providers.SearchRequest, filter service.Filter, limit int) {
+	ew, ok := newEventWriter(w, r)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	res, _, err := svc.SearchStream(r.Context(), req, func(pr service.ProviderResult) {
+		pr.Results = filter.Apply(service.SearchResult{All: pr.Results}).All
+		_ = ew.event("provider", pr)
+	})
+	if err != nil {
+		_ = ew.event("error", errorResponse{Error: err.Error(), Providers: res.Providers})
+		return
+	}
+	res = filter.Apply(res)
+	page := service.Page{Offers: res.All, Total: len(res.All)}
+	if limit > 0 {
+		page = svc.SaveSnapshot(r.Context(), req, res).Page(0, limit)
+	}
+	_ = ew.event("summary", newSearchResponse(req, res, page))
+}
@@ -0,0 +1,131 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/airports"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+// FieldError points at one invalid request parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationError collects every invalid parameter of a request so clients
+// can fix them all in one round trip.
+type validationError struct {
+	fields []FieldError
+}
+
+func (e *validationError) add(field, format string, args ...any) {
+	e.fields = append(e.fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *validationError) Error() string {
+	parts := make([]string, 0, len(e.fields))
+	for _, f := range e.fields {
+		parts = append(parts, f.Field+": "+f.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// validateRoute checks what the providers would otherwise be paid to reject:
+// airport codes must exist in db (airport or city code), origin and
+// destination must differ, and dates must be YYYY-MM-DD, in order and not
+// before today at the departure airport. A nil db skips the code checks.
+func validateRoute(req providers.SearchRequest, db *airports.DB, now time.Time) error {
+	verr := &validationError{}
+	var prev time.Time
+	for i, sl := range req.Slices {
+		field := sliceField(req, i)
+		// a return leg repeats the outbound airports, only its date is new
+		if !(req.IsRoundTrip() && i == 1) {
+			if db != nil {
+				if !db.Known(sl.Origin) {
+					verr.add(field("origin"), "unknown airport or city code %q", sl.Origin)
+				}
+				if !db.Known(sl.Destination) {
+					verr.add(field("destination"), "unknown airport or city code %q", sl.Destination)
+				}
+			}
+			if sameAirport(db, sl.Origin, sl.Destination) {
+				verr.add(field("destination"), "must differ from origin %q", sl.Origin)
+			}
+		}
+
+		day, err := time.Parse(time.DateOnly, sl.Date)
+		if err != nil {
+			verr.add(field("date"), "bad date %q, use YYYY-MM-DD", sl.Date)
+			continue
+		}
+		loc := time.UTC
+		if db != nil {
+			loc = db.Location(sl.Origin)
+		}
+		if sl.Date < now.In(loc).Format(time.DateOnly) {
+			verr.add(field("date"), "%s is in the past", sl.Date)
+		} else if day.Before(prev) {
+			verr.add(field("date"), "%s is before the previous flight", sl.Date)
+		}
+		prev = day
+	}
+	if len(verr.fields) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// sliceField names the query parameters of slice i the way the client sent
+// them: origin/destination/date, return_date for the way back, or
+// slice[i].origin for multi-city requests.
+func sliceField(req providers.SearchRequest, i int) func(string) string {
+	switch {
+	case len(req.Slices) == 1:
+		return func(name string) string { return name }
+	case req.IsRoundTrip():
+		if i == 0 {
+			return func(name string) string { return name }
+		}
+		return func(name string) string { return "return_" + name }
+	default:
+		return func(name string) string { return fmt.Sprintf("slice[%d].%s", i, name) }
+	}
+}
+
+// sameAirport reports whether a and b share an airport, e.g. LHR and LON.
+func sameAirport(db *airports.DB, a, b string) bool {
+	if strings.EqualFold(a, b) {
+		return true
+	}
+	if db == nil {
+		return false
+	}
+	for _, x := range db.Expand(a, 0) {
+		for _, y := range db.Expand(b, 0) {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeBadRequest reports a rejected request as a JSON 400, listing the
+// offending fields when the error is a validation error.
+func writeBadRequest(w http.ResponseWriter, err error) {
+	resp := errorResponse{Error: err.Error()}
+	var verr *validationError
+	if errors.As(err, &verr) {
+		resp = errorResponse{Error: "invalid request", Fields: verr.fields}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(resp)
+}
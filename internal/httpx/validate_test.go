@@ -0,0 +1,108 @@
+package httpx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/airports"
+	"github.com/you/go-jobsity-flights/internal/providers"
+	"github.com/you/go-jobsity-flights/internal/service"
+)
+
+var validateNow = time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func fieldsOf(t *testing.T, err error) []FieldError {
+	t.Helper()
+	require.Error(t, err)
+	verr, ok := err.(*validationError)
+	require.True(t, ok, "want a validation error, got %T", err)
+	return verr.fields
+}
+
+func TestValidateRoute(t *testing.T) {
+	db := airports.Default()
+
+	require.NoError(t, validateRoute(providers.OneWay("AMS", "BCN", "2025-10-01"), db, validateNow))
+	require.NoError(t, validateRoute(providers.OneWay("LON", "NYC", "2025-10-05"), db, validateNow))
+	require.NoError(t, validateRoute(providers.RoundTrip("AMS", "BCN", "2025-10-02", "2025-10-09"), db, validateNow))
+
+	tests := []struct {
+		name string
+		req  providers.SearchRequest
+		want []FieldError
+	}{
+		{"unknown codes", providers.OneWay("XXX", "QQQ", "2025-10-02"), []FieldError{
+			{"origin", `unknown airport or city code "XXX"`},
+			{"destination", `unknown airport or city code "QQQ"`},
+		}},
+		{"same airport", providers.OneWay("AMS", "AMS", "2025-10-02"), []FieldError{
+			{"destination", `must differ from origin "AMS"`},
+		}},
+		{"airport in city", providers.OneWay("LHR", "LON", "2025-10-02"), []FieldError{
+			{"destination", `must differ from origin "LHR"`},
+		}},
+		{"bad date", providers.OneWay("AMS", "BCN", "01/10/2025"), []FieldError{
+			{"date", `bad date "01/10/2025", use YYYY-MM-DD`},
+		}},
+		{"past date", providers.OneWay("AMS", "BCN", "2025-09-30"), []FieldError{
+			{"date", "2025-09-30 is in the past"},
+		}},
+		{"return before outbound", providers.RoundTrip("AMS", "BCN", "2025-10-09", "2025-10-02"), []FieldError{
+			{"return_date", "2025-10-02 is before the previous flight"},
+		}},
+		{"multi-city", providers.SearchRequest{Slices: []providers.Slice{
+			{Origin: "AMS", Destination: "BCN", Date: "2025-10-02"},
+			{Origin: "MAD", Destination: "ZZZ", Date: "2025-10-05"},
+		}}, []FieldError{
+			{"slice[1].destination", `unknown airport or city code "ZZZ"`},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, fieldsOf(t, validateRoute(tt.req, db, validateNow)))
+		})
+	}
+}
+
+func TestValidateRouteUsesOriginTimeZone(t *testing.T) {
+	// 23:30 UTC on 1 Oct is already 2 Oct in Tokyo but still 1 Oct in New York
+	now := time.Date(2025, 10, 1, 23, 30, 0, 0, time.UTC)
+	db := airports.Default()
+
+	require.NoError(t, validateRoute(providers.OneWay("JFK", "LAX", "2025-10-01"), db, now))
+	require.Equal(t, []FieldError{{"date", "2025-10-01 is in the past"}},
+		fieldsOf(t, validateRoute(providers.OneWay("NRT", "LAX", "2025-10-01"), db, now)))
+}
+
+func TestSearchHandlerRejectsBeforeProviders(t *testing.T) {
+	svc := service.NewSearchService(nil, time.Second, time.Second)
+	rec := httptest.NewRecorder()
+	SearchHandler(svc)(rec, httptest.NewRequest(http.MethodGet, "/flights/search?origin=AMS&destination=AMS&date=2020-01-01", nil))
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var body errorResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	require.Equal(t, "invalid request", body.Error)
+	require.Len(t, body.Fields, 2)
+}
+
+func TestAirportsHandler(t *testing.T) {
+	h := AirportsHandler(airports.Default())
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/airports?q=lon&limit=3", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got []airports.Airport
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	require.Len(t, got, 3)
+	require.Equal(t, "LON", got[0].CityCode)
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest(http.MethodGet, "/airports", nil))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,139 @@
+// Package money represents prices exactly, as an integer amount of the
+// currency's minor unit (cents for EUR, yen for JPY, fils for KWD).
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Money is an amount in minor units of an ISO 4217 currency.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// exponents lists currencies whose minor unit is not 1/100.
+var exponents = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// Exponent returns the number of decimal places of the currency's minor unit.
+func Exponent(currency string) int {
+	if e, ok := exponents[strings.ToUpper(currency)]; ok {
+		return e
+	}
+	return 2
+}
+
+func New(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: strings.ToUpper(currency)}
+}
+
+// FromRat rounds r (in major units) half away from zero to the currency's
+// minor unit.
+func FromRat(r *big.Rat, currency string) Money {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(Exponent(currency))))
+	q, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	// |2*rem| >= denominator means we are at or past the half
+	if rem.Abs(rem).Lsh(rem, 1).Cmp(scaled.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(scaled.Sign())))
+	}
+	return New(q.Int64(), currency)
+}
+
+// FromFloat converts a float amount in major units, rounding per currency.
+func FromFloat(v float64, currency string) Money {
+	r, _ := new(big.Rat).SetString(fmt.Sprintf("%.10f", v))
+	return FromRat(r, currency)
+}
+
+// Parse reads a decimal string such as "123.45" exactly.
+func Parse(s, currency string) (Money, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return Money{}, fmt.Errorf("money: bad amount %q", s)
+	}
+	return FromRat(r, currency), nil
+}
+
+// FromUnitsNanos builds an amount from whole units plus billionths, as used
+// by Google-style money payloads.
+func FromUnitsNanos(units, nanos int64, currency string) Money {
+	r := new(big.Rat).SetFrac(big.NewInt(units*1_000_000_000+nanos), big.NewInt(1_000_000_000))
+	return FromRat(r, currency)
+}
+
+func (m Money) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.Amount), pow10(Exponent(m.Currency)))
+}
+
+// Float is for ratios and display only, never for comparisons.
+func (m Money) Float() float64 {
+	f, _ := m.Rat().Float64()
+	return f
+}
+
+func (m Money) IsZero() bool { return m.Amount == 0 }
+
+// String renders the amount in major units, e.g. "123.45".
+func (m Money) String() string {
+	return m.Rat().FloatString(Exponent(m.Currency))
+}
+
+// Cmp compares by value. Amounts in different currencies are compared as
+// plain numbers, callers should normalise currencies first.
+func (m Money) Cmp(o Money) int {
+	return m.Rat().Cmp(o.Rat())
+}
+
+func (m Money) Less(o Money) bool { return m.Cmp(o) < 0 }
+
+var ErrCurrencyMismatch = errors.New("money: currency mismatch")
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	return New(m.Amount+o.Amount, m.Currency), nil
+}
+
+// Convert multiplies by rate (units of currency per unit of m.Currency).
+func (m Money) Convert(rate *big.Rat, currency string) Money {
+	return FromRat(new(big.Rat).Mul(m.Rat(), rate), currency)
+}
+
+type jsonMoney struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON writes {"amount":"123.45","currency":"EUR"}; the amount is a
+// string so clients never see binary floating point.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMoney{Amount: m.String(), Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var j jsonMoney
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	v, err := Parse(j.Amount, j.Currency)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,67 @@
+package money
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoundsPerCurrency(t *testing.T) {
+	cases := []struct {
+		in, cur string
+		minor   int64
+		out     string
+	}{
+		{"123.45", "EUR", 12345, "123.45"},
+		{"123.455", "EUR", 12346, "123.46"},
+		{"-0.005", "EUR", -1, "-0.01"},
+		{"0.3", "usd", 30, "0.30"},
+		{"1999.5", "JPY", 2000, "2000"},
+		{"12.3456", "KWD", 12346, "12.346"},
+		{"7", "EUR", 700, "7.00"},
+	}
+	for _, c := range cases {
+		m, err := Parse(c.in, c.cur)
+		require.NoError(t, err, c.in)
+		require.Equal(t, c.minor, m.Amount, c.in)
+		require.Equal(t, c.out, m.String(), c.in)
+	}
+	_, err := Parse("12,50", "EUR")
+	require.Error(t, err)
+}
+
+func TestFromUnitsNanosAndFloat(t *testing.T) {
+	m := FromUnitsNanos(89, 990000000, "EUR")
+	require.Equal(t, New(8999, "EUR"), m)
+
+	// 0.1+0.2 is not 0.3 in binary, money must not care
+	require.Equal(t, New(30, "EUR"), FromFloat(0.1+0.2, "EUR"))
+	require.Equal(t, New(101, "EUR"), FromFloat(1.005, "EUR"))
+}
+
+func TestCompareAddConvert(t *testing.T) {
+	a, b := New(1000, "EUR"), New(999, "EUR")
+	require.True(t, b.Less(a))
+	require.Equal(t, 0, a.Cmp(New(1000, "EUR")))
+
+	sum, err := a.Add(b)
+	require.NoError(t, err)
+	require.Equal(t, "19.99", sum.String())
+	_, err = a.Add(New(1, "USD"))
+	require.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	usd := New(10000, "USD").Convert(big.NewRat(1, 3), "EUR")
+	require.Equal(t, "33.33", usd.String())
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	b, err := json.Marshal(New(12345, "EUR"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"amount":"123.45","currency":"EUR"}`, string(b))
+
+	var m Money
+	require.NoError(t, json.Unmarshal(b, &m))
+	require.Equal(t, New(12345, "EUR"), m)
+}
@@ -1,117 +1,119 @@
 package providers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/money"
 )
 
 type Amadeus struct {
 	host       string
 	authPath   string
 	searchPath string
-	client     *http.Client
+	client     *http.Client // adds the bearer token
+	limiter    *Limiter
 	id         string
 	secret     string
-	mu         sync.Mutex
-	tok        string
-	expires    time.Time
 }
 
 func NewAmadeus(cfg *config.Config) *Amadeus {
-	return &Amadeus{host: cfg.AmadeusURL,
+	limiter := NewLimiter("amadeus", cfg.RateLimits["amadeus"])
+	a := &Amadeus{host: cfg.AmadeusURL,
 		authPath:   "/v1/security/oauth2/token",
 		searchPath: "/v2/shopping/flight-offers",
 		id:         cfg.AmadeusClientId,
 		secret:     cfg.AmadeusClientSSecret,
-		client:     http.DefaultClient,
+		limiter:    limiter,
 	}
+	limited := limiter.Client(http.DefaultClient)
+	tokens := NewClientCredentials("amadeus", a.host+a.authPath, a.id, a.secret, limited)
+	a.client = tokens.Client(limited)
+	return a
 }
 
 func (a *Amadeus) Name() string { return "amadeus" }
 
-func (a *Amadeus) token(ctx context.Context) (string, error) {
-	//a.mu.Lock()
-	//defer a.mu.Unlock()
-	//if a.tok != "" && time.Now().Before(a.expires.Add(-10*time.Second)) {
-	//	return a.tok, nil
-	//}
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
-	data.Set("client_id", a.id)
-	data.Set("client_secret", a.secret)
-	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, a.host+a.authPath, strings.NewReader(data.Encode()))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := a.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		return "", fmt.Errorf("amadeus token: %s", resp.Status)
-	}
-	var tr struct {
-		AccessToken string `json:"access_token"`
-		ExpiresIn   int    `json:"expires_in"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
-		return "", err
-	}
-	a.tok = tr.AccessToken
-	a.expires = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
-	return a.tok, nil
-}
+// Usage reports the rate limiter and quota counters of this provider.
+func (a *Amadeus) Usage() Usage { return a.limiter.Usage() }
 
-func (a *Amadeus) Search(ctx context.Context, origin, destination, date string) ([]FlightOffer, error) {
+func (a *Amadeus) Search(ctx context.Context, sr SearchRequest) ([]FlightOffer, error) {
 	if a.id == "" || a.secret == "" {
 		return nil, errors.New("amadeus credentials missing")
 	}
-	tok, err := a.token(ctx)
-	if err != nil {
-		return nil, err
+	// One-way and return trips fit the GET endpoint; anything else (open-jaw,
+	// multi-city) needs the POST variant with explicit originDestinations.
+	var req *http.Request
+	u := a.host + a.searchPath
+	if len(sr.Slices) == 1 || sr.IsRoundTrip() {
+		first := sr.Slices[0]
+		q := url.Values{}
+		q.Set("originLocationCode", first.Origin)
+		q.Set("destinationLocationCode", first.Destination)
+		q.Set("departureDate", first.Date)
+		if sr.IsRoundTrip() {
+			q.Set("returnDate", sr.Slices[1].Date)
+		}
+		q.Set("adults", strconv.Itoa(sr.Passengers.Adults))
+		if sr.Passengers.Children > 0 {
+			q.Set("children", strconv.Itoa(sr.Passengers.Children))
+		}
+		if sr.Passengers.Infants > 0 {
+			q.Set("infants", strconv.Itoa(sr.Passengers.Infants))
+		}
+		q.Set("travelClass", amadeusCabin(sr.Cabin))
+		q.Set("currencyCode", sr.Currency)
+		q.Set("max", "5")
+		u += "?" + q.Encode()
+		req, _ = http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	} else {
+		b, _ := json.Marshal(newAmadeusOfferRequest(sr))
+		req, _ = http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-HTTP-Method-Override", "GET")
 	}
-
-	u := fmt.Sprintf("%s%s?originLocationCode=%s&destinationLocationCode=%s&departureDate=%s&adults=1&currencyCode=EUR&max=5",
-		a.host,
-		a.searchPath,
-		url.QueryEscape(origin),
-		url.QueryEscape(destination),
-		url.QueryEscape(date))
-
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
-	req.Header.Set("Authorization", "Bearer "+tok)
 	resp, err := a.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("amadeus search: %s - %s - %s", resp.Status, u, tok)
+		return nil, newStatusError("amadeus search", resp)
 	}
 
 	var payload struct {
 		Data []struct {
 			Price struct {
-				Total string `json:"total"`
+				Currency string `json:"currency"`
+				Total    string `json:"total"`
 			} `json:"price"`
 			Itineraries []struct {
 				Duration string `json:"duration"` // ISO8601 e.g. PT2H10M
 				Segments []struct {
 					Departure struct {
-						At string `json:"at"`
-					}
+						IataCode string `json:"iataCode"`
+						At       string `json:"at"`
+					} `json:"departure"`
 					Arrival struct {
-						At string `json:"at"`
-					}
+						IataCode string `json:"iataCode"`
+						At       string `json:"at"`
+					} `json:"arrival"`
+					CarrierCode string `json:"carrierCode"`
+					Number      string `json:"number"`
+					Aircraft    struct {
+						Code string `json:"code"`
+					} `json:"aircraft"`
+					Operating struct {
+						CarrierCode string `json:"carrierCode"`
+					} `json:"operating"`
+					Duration string `json:"duration"`
 				} `json:"segments"`
 			} `json:"itineraries"`
 		} `json:"data"`
@@ -121,28 +123,134 @@ func (a *Amadeus) Search(ctx context.Context, origin, destination, date string)
 	}
 
 	var out []FlightOffer
+offers:
 	for _, d := range payload.Data {
-		if len(d.Itineraries) == 0 || len(d.Itineraries[0].Segments) == 0 {
+		if len(d.Itineraries) == 0 {
+			continue
+		}
+		its := make([]Itinerary, 0, len(d.Itineraries))
+		for _, it := range d.Itineraries {
+			if len(it.Segments) == 0 {
+				continue offers
+			}
+			segs := make([]Segment, 0, len(it.Segments))
+			for _, sg := range it.Segments {
+				segs = append(segs, Segment{
+					MarketingCarrier: sg.CarrierCode,
+					OperatingCarrier: sg.Operating.CarrierCode,
+					FlightNumber:     sg.CarrierCode + sg.Number,
+					Aircraft:         sg.Aircraft.Code,
+					Origin:           sg.Departure.IataCode,
+					Destination:      sg.Arrival.IataCode,
+					DepartAt:         airportTime(sg.Departure.At, sg.Departure.IataCode),
+					ArriveAt:         airportTime(sg.Arrival.At, sg.Arrival.IataCode),
+					DurationMin:      parseISODurationMinutes(sg.Duration),
+				})
+			}
+			its = append(its, newItinerary(segs, parseISODurationMinutes(it.Duration)))
+		}
+		currency := d.Price.Currency
+		if currency == "" {
+			currency = sr.Currency
+		}
+		price, err := money.Parse(d.Price.Total, currency)
+		if err != nil {
 			continue
 		}
-		price, _ := strconv.ParseFloat(d.Price.Total, 64)
-		segFirst := d.Itineraries[0].Segments[0]
-		segLast := d.Itineraries[0].Segments[len(d.Itineraries[0].Segments)-1]
-		depart, _ := parseAmadeusTime(segFirst.Departure.At)
-		arrive, _ := parseAmadeusTime(segLast.Arrival.At)
-		dur := parseISODurationMinutes(d.Itineraries[0].Duration)
 		out = append(out, FlightOffer{
-			Provider:    a.Name(),
-			Price:       price,
-			Currency:    "EUR",
-			DurationMin: dur,
-			DepartAt:    depart,
-			ArriveAt:    arrive,
-		})
+			Provider: a.Name(),
+			Price:    price,
+		}.withItineraries(its))
 	}
 	return out, nil
 }
 
+type amadeusOriginDestination struct {
+	ID                      string `json:"id"`
+	OriginLocationCode      string `json:"originLocationCode"`
+	DestinationLocationCode string `json:"destinationLocationCode"`
+	DepartureDateTimeRange  struct {
+		Date string `json:"date"`
+	} `json:"departureDateTimeRange"`
+}
+
+type amadeusTraveler struct {
+	ID                string `json:"id"`
+	TravelerType      string `json:"travelerType"`
+	AssociatedAdultID string `json:"associatedAdultId,omitempty"`
+}
+
+type amadeusCabinRestriction struct {
+	Cabin                string   `json:"cabin"`
+	Coverage             string   `json:"coverage"`
+	OriginDestinationIDs []string `json:"originDestinationIds"`
+}
+
+type amadeusOfferRequest struct {
+	CurrencyCode       string                     `json:"currencyCode"`
+	OriginDestinations []amadeusOriginDestination `json:"originDestinations"`
+	Travelers          []amadeusTraveler          `json:"travelers"`
+	Sources            []string                   `json:"sources"`
+	SearchCriteria     struct {
+		MaxFlightOffers int `json:"maxFlightOffers"`
+		FlightFilters   struct {
+			CabinRestrictions []amadeusCabinRestriction `json:"cabinRestrictions"`
+		} `json:"flightFilters"`
+	} `json:"searchCriteria"`
+}
+
+func newAmadeusOfferRequest(sr SearchRequest) amadeusOfferRequest {
+	body := amadeusOfferRequest{
+		CurrencyCode: sr.Currency,
+		Sources:      []string{"GDS"},
+	}
+	body.SearchCriteria.MaxFlightOffers = 5
+
+	ids := make([]string, 0, len(sr.Slices))
+	for i, s := range sr.Slices {
+		od := amadeusOriginDestination{
+			ID:                      strconv.Itoa(i + 1),
+			OriginLocationCode:      s.Origin,
+			DestinationLocationCode: s.Destination,
+		}
+		od.DepartureDateTimeRange.Date = s.Date
+		body.OriginDestinations = append(body.OriginDestinations, od)
+		ids = append(ids, od.ID)
+	}
+	body.SearchCriteria.FlightFilters.CabinRestrictions = []amadeusCabinRestriction{
+		{Cabin: amadeusCabin(sr.Cabin), Coverage: "MOST_SEGMENTS", OriginDestinationIDs: ids},
+	}
+
+	// travelers are numbered adults first so infants can point at their adult
+	n := 0
+	add := func(typ, adult string) {
+		n++
+		body.Travelers = append(body.Travelers, amadeusTraveler{ID: strconv.Itoa(n), TravelerType: typ, AssociatedAdultID: adult})
+	}
+	for range sr.Passengers.Adults {
+		add("ADULT", "")
+	}
+	for range sr.Passengers.Children {
+		add("CHILD", "")
+	}
+	for i := range sr.Passengers.Infants {
+		add("HELD_INFANT", strconv.Itoa(i+1))
+	}
+	return body
+}
+
+func amadeusCabin(c CabinClass) string {
+	switch c {
+	case CabinPremium:
+		return "PREMIUM_ECONOMY"
+	case CabinBusiness:
+		return "BUSINESS"
+	case CabinFirst:
+		return "FIRST"
+	}
+	return "ECONOMY"
+}
+
 func parseISODurationMinutes(s string) int {
 	// very small parser for formats like PT2H10M, PT150M
 	s = strings.TrimPrefix(s, "PT")
@@ -164,19 +272,3 @@ func parseISODurationMinutes(s string) int {
 	}
 	return total
 }
-
-func parseAmadeusTime(s string) (time.Time, error) {
-	// Amadeus returns local time without offset, e.g. 2025-09-10T08:45:00
-	// Treat it as "naive" time. Use Local (or time.UTC if you prefer).
-	if t, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local); err == nil {
-		return t, nil
-	}
-	// Fallbacks if they ever include zone
-	if t, err := time.Parse(time.RFC3339, s); err == nil {
-		return t, nil
-	}
-	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
-		return t, nil
-	}
-	return time.Time{}, fmt.Errorf("unsupported time format: %q", s)
-}
@@ -0,0 +1,155 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/money"
+)
+
+// amadeusOffers is a trimmed /v2/shopping/flight-offers response: a return
+// trip out via LHR and back direct, with the naive local times Amadeus uses.
+const amadeusOffers = `{
+  "meta": {"count": 1},
+  "data": [{
+    "type": "flight-offer",
+    "id": "1",
+    "source": "GDS",
+    "itineraries": [
+      {"duration": "PT11H", "segments": [
+        {"departure": {"iataCode": "AMS", "at": "2025-10-01T10:00:00"},
+         "arrival": {"iataCode": "LHR", "terminal": "4", "at": "2025-10-01T10:20:00"},
+         "carrierCode": "KL", "number": "1001", "aircraft": {"code": "73H"},
+         "operating": {"carrierCode": "KL"}, "duration": "PT1H20M", "numberOfStops": 0},
+        {"departure": {"iataCode": "LHR", "terminal": "5", "at": "2025-10-01T12:00:00"},
+         "arrival": {"iataCode": "JFK", "terminal": "7", "at": "2025-10-01T15:00:00"},
+         "carrierCode": "BA", "number": "117", "aircraft": {"code": "777"},
+         "operating": {"carrierCode": "AA"}, "duration": "PT8H", "numberOfStops": 0}
+      ]},
+      {"duration": "PT7H50M", "segments": [
+        {"departure": {"iataCode": "JFK", "at": "2025-10-08T18:00:00"},
+         "arrival": {"iataCode": "AMS", "at": "2025-10-09T07:50:00"},
+         "carrierCode": "KL", "number": "642", "aircraft": {"code": "781"},
+         "duration": "PT7H50M", "numberOfStops": 0}
+      ]}
+    ],
+    "price": {"currency": "EUR", "total": "512.30", "base": "401.00", "grandTotal": "512.30"}
+  }]
+}`
+
+// newFakeAmadeus serves the OAuth token and hands searches to search.
+func newFakeAmadeus(t *testing.T, search http.HandlerFunc) *Amadeus {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/security/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"abc","expires_in":1799}`)
+	})
+	mux.HandleFunc("/v2/shopping/flight-offers", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+		search(w, r)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return NewAmadeus(&config.Config{AmadeusURL: srv.URL, AmadeusClientId: "id", AmadeusClientSSecret: "secret"})
+}
+
+func TestAmadeus_RoundTrip(t *testing.T) {
+	a := newFakeAmadeus(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodGet, r.Method)
+		q := r.URL.Query()
+		require.Equal(t, "AMS", q.Get("originLocationCode"))
+		require.Equal(t, "JFK", q.Get("destinationLocationCode"))
+		require.Equal(t, "2025-10-01", q.Get("departureDate"))
+		require.Equal(t, "2025-10-08", q.Get("returnDate"))
+		require.Equal(t, "2", q.Get("adults"))
+		require.Equal(t, "1", q.Get("children"))
+		require.Equal(t, "1", q.Get("infants"))
+		require.Equal(t, "BUSINESS", q.Get("travelClass"))
+		require.Equal(t, "EUR", q.Get("currencyCode"))
+		fmt.Fprint(w, amadeusOffers)
+	})
+
+	req := RoundTrip("AMS", "JFK", "2025-10-01", "2025-10-08")
+	req.Passengers = Passengers{Adults: 2, Children: 1, Infants: 1}
+	req.Cabin = CabinBusiness
+	offers, err := a.Search(context.Background(), req.WithDefaults())
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+
+	o := offers[0]
+	price, _ := money.Parse("512.30", "EUR")
+	require.Equal(t, "amadeus", o.Provider)
+	require.Equal(t, price, o.Price)
+	require.Len(t, o.Itineraries, 2)
+	require.Equal(t, 11*60+7*60+50, o.DurationMin)
+	require.Equal(t, 1, o.Stops)
+
+	out := o.Itineraries[0]
+	require.Equal(t, "AMS", out.Origin)
+	require.Equal(t, "JFK", out.Destination)
+	require.Equal(t, 1, out.Stops)
+	require.Equal(t, 660, out.DurationMin)
+	require.Len(t, out.Segments, 2)
+	require.Equal(t, Segment{
+		MarketingCarrier: "KL", OperatingCarrier: "KL", FlightNumber: "KL1001", Aircraft: "73H",
+		Origin: "AMS", Destination: "LHR",
+		DepartAt:    airportTime("2025-10-01T10:00:00", "AMS"),
+		ArriveAt:    airportTime("2025-10-01T10:20:00", "LHR"),
+		DurationMin: 80, LayoverMin: 100, // 10:20 BST to 12:00 BST
+	}, out.Segments[0])
+	require.Equal(t, "BA117", out.Segments[1].FlightNumber)
+	require.Equal(t, "AA", out.Segments[1].OperatingCarrier)
+	require.Zero(t, out.Segments[1].LayoverMin)
+
+	back := o.Itineraries[1]
+	require.Zero(t, back.Stops)
+	require.Equal(t, "2025-10-09T05:50:00Z", back.ArriveAt.UTC().Format("2006-01-02T15:04:05Z"))
+}
+
+func TestAmadeus_MultiCityPostsOriginDestinations(t *testing.T) {
+	a := newFakeAmadeus(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "GET", r.Header.Get("X-HTTP-Method-Override"))
+		var body amadeusOfferRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		require.Equal(t, "EUR", body.CurrencyCode)
+		require.Len(t, body.OriginDestinations, 3)
+		for i, want := range [][3]string{
+			{"AMS", "BCN", "2025-10-01"},
+			{"BCN", "LIS", "2025-10-05"},
+			{"LIS", "AMS", "2025-10-09"},
+		} {
+			od := body.OriginDestinations[i]
+			require.Equal(t, fmt.Sprint(i+1), od.ID)
+			require.Equal(t, want, [3]string{od.OriginLocationCode, od.DestinationLocationCode, od.DepartureDateTimeRange.Date})
+		}
+		require.Equal(t, []amadeusTraveler{
+			{ID: "1", TravelerType: "ADULT"},
+			{ID: "2", TravelerType: "ADULT"},
+			{ID: "3", TravelerType: "CHILD"},
+			{ID: "4", TravelerType: "HELD_INFANT", AssociatedAdultID: "1"},
+		}, body.Travelers)
+		require.Equal(t, []amadeusCabinRestriction{
+			{Cabin: "ECONOMY", Coverage: "MOST_SEGMENTS", OriginDestinationIDs: []string{"1", "2", "3"}},
+		}, body.SearchCriteria.FlightFilters.CabinRestrictions)
+		fmt.Fprint(w, `{"data":[]}`)
+	})
+
+	req := SearchRequest{
+		Slices: []Slice{
+			{Origin: "AMS", Destination: "BCN", Date: "2025-10-01"},
+			{Origin: "BCN", Destination: "LIS", Date: "2025-10-05"},
+			{Origin: "LIS", Destination: "AMS", Date: "2025-10-09"},
+		},
+		Passengers: Passengers{Adults: 2, Children: 1, Infants: 1},
+	}
+	offers, err := a.Search(context.Background(), req.WithDefaults())
+	require.NoError(t, err)
+	require.Empty(t, offers)
+}
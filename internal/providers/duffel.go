@@ -5,24 +5,25 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/money"
 )
 
 type Duffel struct {
-	host   string
-	token  string
-	client *http.Client
+	host    string
+	token   string
+	client  *http.Client
+	limiter *Limiter
 }
 
 func NewDuffel(cfg *config.Config) *Duffel {
+	limiter := NewLimiter("duffel", cfg.RateLimits["duffel"])
 	return &Duffel{host: cfg.DuffelHost,
-		token:  cfg.DuffelToken,
-		client: http.DefaultClient,
+		token:   cfg.DuffelToken,
+		client:  limiter.Client(http.DefaultClient),
+		limiter: limiter,
 	}
 }
 
@@ -30,18 +31,25 @@ func (d *Duffel) Name() string {
 	return "duffel"
 }
 
+// Usage reports the rate limiter and quota counters of this provider.
+func (d *Duffel) Usage() Usage { return d.limiter.Usage() }
+
+type duffelSlice struct {
+	Origin        string `json:"origin"`
+	Destination   string `json:"destination"`
+	DepartureDate string `json:"departure_date"`
+}
+
+type duffelPassenger struct {
+	Type string `json:"type"`
+}
+
 type duffelOfferRequest struct {
-	Slices []struct {
-		Origin        string `json:"origin"`
-		Destination   string `json:"destination"`
-		DepartureDate string `json:"departure_date"`
-	} `json:"slices"`
-	Passengers []struct {
-		Type string `json:"type"`
-	} `json:"passengers"`
-	CabinClass   string `json:"cabin_class"`
-	CurrencyCode string `json:"currency"`
-	ReturnOffers bool   `json:"return_offers"`
+	Slices       []duffelSlice     `json:"slices"`
+	Passengers   []duffelPassenger `json:"passengers"`
+	CabinClass   string            `json:"cabin_class"`
+	CurrencyCode string            `json:"currency"`
+	ReturnOffers bool              `json:"return_offers"`
 }
 
 type duffelOfferRequestEnvelope struct {
@@ -52,40 +60,51 @@ type duffelOffer struct {
 	TotalAmount   string `json:"total_amount"`
 	TotalCurrency string `json:"total_currency"`
 	Slices        []struct {
+		Duration string `json:"duration"` // ISO8601 e.g. PT2H10M
 		Segments []struct {
-			DepartingAt string `json:"departing_at"`
-			ArrivingAt  string `json:"arriving_at"`
-			Duration    string `json:"duration"` // ISO8601 e.g. PT2H10M
+			Origin struct {
+				IataCode string `json:"iata_code"`
+			} `json:"origin"`
+			Destination struct {
+				IataCode string `json:"iata_code"`
+			} `json:"destination"`
+			DepartingAt                  string        `json:"departing_at"`
+			ArrivingAt                   string        `json:"arriving_at"`
+			Duration                     string        `json:"duration"` // ISO8601 e.g. PT2H10M
+			MarketingCarrier             duffelCarrier `json:"marketing_carrier"`
+			OperatingCarrier             duffelCarrier `json:"operating_carrier"`
+			MarketingCarrierFlightNumber string        `json:"marketing_carrier_flight_number"`
+			Aircraft                     struct {
+				IataCode string `json:"iata_code"`
+			} `json:"aircraft"`
 		} `json:"segments"`
 	} `json:"slices"`
 }
 
+type duffelCarrier struct {
+	IataCode string `json:"iata_code"`
+}
+
 type duffelOfferResp struct {
 	Data struct {
 		Offers []duffelOffer `json:"offers"`
 	} `json:"data"`
 }
 
-func (d *Duffel) Search(ctx context.Context, origin, destination, date string) ([]FlightOffer, error) {
+func (d *Duffel) Search(ctx context.Context, sr SearchRequest) ([]FlightOffer, error) {
 	if d.token == "" {
 		return nil, errors.New("duffel token missing")
 	}
 
+	slices := make([]duffelSlice, 0, len(sr.Slices))
+	for _, s := range sr.Slices {
+		slices = append(slices, duffelSlice{Origin: s.Origin, Destination: s.Destination, DepartureDate: s.Date})
+	}
 	reqBody := duffelOfferRequestEnvelope{Data: duffelOfferRequest{
-		Slices: []struct {
-			Origin        string `json:"origin"`
-			Destination   string `json:"destination"`
-			DepartureDate string `json:"departure_date"`
-		}([]struct {
-			Origin, Destination, DepartureDate string `json:"origin" json:"destination" json:"departure_date"`
-		}{
-			{Origin: origin, Destination: destination, DepartureDate: date},
-		}),
-		Passengers: []struct {
-			Type string `json:"type"`
-		}{{Type: "adult"}},
-		CabinClass:   "economy",
-		CurrencyCode: "EUR",
+		Slices:       slices,
+		Passengers:   duffelPassengers(sr.Passengers),
+		CabinClass:   duffelCabin(sr.Cabin),
+		CurrencyCode: sr.Currency,
 		ReturnOffers: true,
 	}}
 	b, _ := json.Marshal(reqBody)
@@ -101,7 +120,7 @@ func (d *Duffel) Search(ctx context.Context, origin, destination, date string) (
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("duffel: %s", resp.Status)
+		return nil, newStatusError("duffel", resp)
 	}
 
 	var pr duffelOfferResp
@@ -110,33 +129,64 @@ func (d *Duffel) Search(ctx context.Context, origin, destination, date string) (
 	}
 
 	var out []FlightOffer
+offers:
 	for _, o := range pr.Data.Offers {
-		if len(o.Slices) == 0 || len(o.Slices[0].Segments) == 0 {
+		if len(o.Slices) == 0 {
+			continue
+		}
+		its := make([]Itinerary, 0, len(o.Slices))
+		for _, sl := range o.Slices {
+			if len(sl.Segments) == 0 {
+				continue offers
+			}
+			segs := make([]Segment, 0, len(sl.Segments))
+			for _, sg := range sl.Segments {
+				segs = append(segs, Segment{
+					MarketingCarrier: sg.MarketingCarrier.IataCode,
+					OperatingCarrier: sg.OperatingCarrier.IataCode,
+					FlightNumber:     sg.MarketingCarrier.IataCode + sg.MarketingCarrierFlightNumber,
+					Aircraft:         sg.Aircraft.IataCode,
+					Origin:           sg.Origin.IataCode,
+					Destination:      sg.Destination.IataCode,
+					DepartAt:         airportTime(sg.DepartingAt, sg.Origin.IataCode),
+					ArriveAt:         airportTime(sg.ArrivingAt, sg.Destination.IataCode),
+					DurationMin:      parseISODurationMinutes(sg.Duration),
+				})
+			}
+			its = append(its, newItinerary(segs, parseISODurationMinutes(sl.Duration)))
+		}
+		currency := o.TotalCurrency
+		if currency == "" {
+			currency = sr.Currency
+		}
+		price, err := money.Parse(o.TotalAmount, currency)
+		if err != nil {
 			continue
 		}
-		seg0 := o.Slices[0].Segments[0]
-		segn := o.Slices[0].Segments[len(o.Slices[0].Segments)-1]
-		depart := mustParseDuffelTime(seg0.DepartingAt)
-		arrive := mustParseDuffelTime(segn.ArrivingAt)
-		dur := parseISODurationMinutes(seg0.Duration)
-		price, _ := strconv.ParseFloat(o.TotalAmount, 64)
-		currency := "EUR"
 		out = append(out, FlightOffer{Provider: d.Name(),
-			Price:       price,
-			Currency:    currency,
-			DurationMin: dur,
-			DepartAt:    depart,
-			ArriveAt:    arrive})
+			Price: price,
+		}.withItineraries(its))
 	}
 	return out, nil
 }
 
-func mustParseDuffelTime(s string) time.Time {
-	if t, err := time.Parse(time.RFC3339, s); err == nil {
-		return t
+func duffelPassengers(p Passengers) []duffelPassenger {
+	out := make([]duffelPassenger, 0, p.Adults+p.Children+p.Infants)
+	for range p.Adults {
+		out = append(out, duffelPassenger{Type: "adult"})
 	}
-	if t, err := time.Parse("2006-01-02T15:04:05", s); err == nil {
-		return t.UTC()
+	for range p.Children {
+		out = append(out, duffelPassenger{Type: "child"})
+	}
+	for range p.Infants {
+		out = append(out, duffelPassenger{Type: "infant_without_seat"})
+	}
+	return out
+}
+
+func duffelCabin(c CabinClass) string {
+	if c == CabinPremium {
+		return "premium_economy"
 	}
-	return time.Time{}
+	return string(c)
 }
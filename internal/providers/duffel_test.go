@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/money"
+)
+
+// duffelOffers is a trimmed offer request response: a return trip LHR-BCN
+// coming back via MAD, plus an offer without segments that must be skipped.
+const duffelOffers = `{
+  "data": {
+    "id": "orq_0000AgYjCzAeFbOCJt6cHF",
+    "live_mode": false,
+    "offers": [
+      {"id": "off_0000AgYjD0Gj1ws0g3Jv9g", "total_amount": "245.10", "total_currency": "GBP",
+       "slices": [
+        {"duration": "PT2H5M", "segments": [
+          {"origin": {"iata_code": "LHR", "name": "Heathrow"}, "destination": {"iata_code": "BCN"},
+           "departing_at": "2025-10-01T07:05:00", "arriving_at": "2025-10-01T10:10:00", "duration": "PT2H5M",
+           "marketing_carrier": {"iata_code": "BA", "name": "British Airways"}, "operating_carrier": {"iata_code": "BA"},
+           "marketing_carrier_flight_number": "478", "aircraft": {"iata_code": "320", "name": "Airbus A320"}}
+        ]},
+        {"duration": "PT5H25M", "segments": [
+          {"origin": {"iata_code": "BCN"}, "destination": {"iata_code": "MAD"},
+           "departing_at": "2025-10-08T18:00:00", "arriving_at": "2025-10-08T19:25:00", "duration": "PT1H25M",
+           "marketing_carrier": {"iata_code": "IB"}, "operating_carrier": {"iata_code": "I2"},
+           "marketing_carrier_flight_number": "1947", "aircraft": {"iata_code": "32N"}},
+          {"origin": {"iata_code": "MAD"}, "destination": {"iata_code": "LHR"},
+           "departing_at": "2025-10-08T21:00:00", "arriving_at": "2025-10-08T22:25:00", "duration": "PT2H25M",
+           "marketing_carrier": {"iata_code": "IB"}, "operating_carrier": {"iata_code": "IB"},
+           "marketing_carrier_flight_number": "3176", "aircraft": {"iata_code": "321"}}
+        ]}
+      ]},
+      {"id": "off_0000AgYjD0Gj1ws0g3Jv9h", "total_amount": "199.00", "total_currency": "GBP",
+       "slices": [{"duration": "PT2H5M", "segments": []}]}
+    ]
+  }
+}`
+
+func TestDuffel_RoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/air/offer_requests", r.URL.Path)
+		require.Equal(t, "Bearer tok", r.Header.Get("Authorization"))
+		require.Equal(t, "v2", r.Header.Get("Duffel-Version"))
+
+		var body duffelOfferRequestEnvelope
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, duffelOfferRequest{
+			Slices: []duffelSlice{
+				{Origin: "LHR", Destination: "BCN", DepartureDate: "2025-10-01"},
+				{Origin: "BCN", Destination: "LHR", DepartureDate: "2025-10-08"},
+			},
+			Passengers:   []duffelPassenger{{Type: "adult"}, {Type: "child"}, {Type: "infant_without_seat"}},
+			CabinClass:   "premium_economy",
+			CurrencyCode: "GBP",
+			ReturnOffers: true,
+		}, body.Data)
+		fmt.Fprint(w, duffelOffers)
+	}))
+	defer srv.Close()
+
+	d := NewDuffel(&config.Config{DuffelHost: srv.URL, DuffelToken: "tok"})
+	req := RoundTrip("LHR", "BCN", "2025-10-01", "2025-10-08")
+	req.Passengers = Passengers{Adults: 1, Children: 1, Infants: 1}
+	req.Cabin = CabinPremium
+	req.Currency = "gbp"
+	offers, err := d.Search(context.Background(), req.WithDefaults())
+	require.NoError(t, err)
+	require.Len(t, offers, 1, "the offer without segments is dropped")
+
+	o := offers[0]
+	price, _ := money.Parse("245.10", "GBP")
+	require.Equal(t, "duffel", o.Provider)
+	require.Equal(t, price, o.Price)
+	require.Equal(t, 125+325, o.DurationMin)
+	require.Equal(t, 1, o.Stops)
+	require.Equal(t, []string{"BA", "IB", "I2"}, o.Carriers())
+
+	out := o.Itineraries[0]
+	require.Zero(t, out.Stops)
+	require.Equal(t, "BA478", out.Segments[0].FlightNumber)
+	require.Equal(t, "320", out.Segments[0].Aircraft)
+	require.Equal(t, 125, out.Segments[0].DurationMin)
+
+	back := o.Itineraries[1]
+	require.Equal(t, "BCN", back.Origin)
+	require.Equal(t, "LHR", back.Destination)
+	require.Equal(t, 1, back.Stops)
+	require.Equal(t, 325, back.DurationMin)
+	require.Equal(t, 95, back.Segments[0].LayoverMin) // 19:25 to 21:00 in MAD
+	require.Equal(t, 145, back.Segments[1].DurationMin)
+	require.Equal(t, "2025-10-08T22:25:00+01:00", back.ArriveAt.Format("2006-01-02T15:04:05Z07:00"))
+}
@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusError is a non-2xx answer from a provider API.
+type StatusError struct {
+	Op         string // e.g. "amadeus search"
+	StatusCode int
+	Status     string
+	// RetryAfter is the server's Retry-After hint, 0 when absent.
+	RetryAfter time.Duration
+}
+
+func newStatusError(op string, resp *http.Response) *StatusError {
+	return &StatusError{
+		Op:         op,
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Status)
+}
+
+// Temporary reports whether repeating the request may succeed: rate
+// limiting (429) and server-side failures (5xx).
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// parseRetryAfter reads either delay-seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// IsTransient reports whether err is worth retrying and counts against a
+// provider's health: temporary HTTP statuses, network failures and
+// timeouts. Bad requests, missing credentials or unsupported searches are
+// not, and neither is the caller giving up. Our own rate limiter refusing
+// a call is not a provider failure either.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrQuotaExhausted) || errors.Is(err, ErrRateLimited) {
+		return false
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
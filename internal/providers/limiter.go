@@ -0,0 +1,265 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/config"
+)
+
+var (
+	// ErrQuotaExhausted is returned instead of calling a provider whose
+	// daily or monthly quota is used up, or which reported no requests left.
+	ErrQuotaExhausted = errors.New("quota exhausted")
+	// ErrRateLimited is returned when waiting for the rate limiter would
+	// outlast the caller's deadline.
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// defaultQuotaPause is how long a provider that reported zero remaining
+// requests is left alone when it gave no reset time.
+const defaultQuotaPause = time.Minute
+
+// Usage is a snapshot of a provider's rate limiter and quota counters.
+type Usage struct {
+	Provider     string     `json:"provider"`
+	RPS          float64    `json:"rps,omitempty"`
+	Burst        int        `json:"burst,omitempty"`
+	Daily        int        `json:"daily"` // calls made today (UTC)
+	DailyLimit   int        `json:"daily_limit,omitempty"`
+	Monthly      int        `json:"monthly"` // calls made this month (UTC)
+	MonthlyLimit int        `json:"monthly_limit,omitempty"`
+	Remaining    *int       `json:"remaining,omitempty"` // as last reported by the provider
+	ResetAt      *time.Time `json:"reset_at,omitempty"`
+	Exhausted    bool       `json:"exhausted"`
+}
+
+// Limiter paces the outbound requests of one provider with a token bucket
+// and counts them against daily and monthly quotas. Rate-limit headers on
+// the provider's responses tighten it further: bursts never exceed what
+// the provider says is left, and once it reports none the limiter refuses
+// calls until the advertised reset.
+type Limiter struct {
+	name   string
+	limits config.RateLimit
+	now    func() time.Time
+	sleep  func(context.Context, time.Duration) error
+
+	mu        sync.Mutex
+	tokens    float64
+	last      time.Time
+	day       string // UTC day the daily counter belongs to
+	month     string // UTC month the monthly counter belongs to
+	daily     int
+	monthly   int
+	remaining int // reported by the provider, -1 when unknown
+	resetAt   time.Time
+}
+
+// NewLimiter builds the limiter of one provider. Burst defaults to the
+// rate rounded up, and at least 1.
+func NewLimiter(name string, limits config.RateLimit) *Limiter {
+	if limits.RPS > 0 && limits.Burst <= 0 {
+		limits.Burst = max(int(math.Ceil(limits.RPS)), 1)
+	}
+	return &Limiter{
+		name:      name,
+		limits:    limits,
+		now:       time.Now,
+		sleep:     sleepCtx,
+		tokens:    float64(limits.Burst),
+		remaining: -1,
+	}
+}
+
+// Wait blocks until a call may be made and counts it. It fails at once
+// with ErrQuotaExhausted when no quota is left, and with ErrRateLimited
+// when the wait would run past ctx's deadline.
+func (l *Limiter) Wait(ctx context.Context) error {
+	for {
+		wait, err := l.reserve()
+		if err != nil || wait == 0 {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && l.now().Add(wait).After(deadline) {
+			return fmt.Errorf("%s: %w", l.name, ErrRateLimited)
+		}
+		if err := l.sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// reserve takes a token and counts the call, or says how long until a
+// token is available.
+func (l *Limiter) reserve() (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.rollover(now)
+	if err := l.exhausted(now); err != nil {
+		return 0, err
+	}
+	if l.limits.RPS > 0 {
+		l.refill(now)
+		if l.tokens < 1 {
+			secs := (1 - l.tokens) / l.limits.RPS
+			return time.Duration(math.Ceil(secs * float64(time.Second))), nil
+		}
+		l.tokens--
+	}
+	l.daily++
+	l.monthly++
+	if l.remaining > 0 {
+		l.remaining--
+	}
+	return 0, nil
+}
+
+func (l *Limiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.limits.RPS
+	}
+	l.last = now
+	limit := float64(l.limits.Burst)
+	if l.remaining >= 0 {
+		limit = min(limit, float64(l.remaining))
+	}
+	l.tokens = min(l.tokens, limit)
+}
+
+// rollover resets the quota counters when a new UTC day or month starts,
+// and forgets the provider's remaining count once its reset has passed.
+func (l *Limiter) rollover(now time.Time) {
+	utc := now.UTC()
+	if day := utc.Format(time.DateOnly); day != l.day {
+		l.day, l.daily = day, 0
+	}
+	if month := utc.Format("2006-01"); month != l.month {
+		l.month, l.monthly = month, 0
+	}
+	if l.remaining >= 0 && !l.resetAt.IsZero() && !now.Before(l.resetAt) {
+		l.remaining, l.resetAt = -1, time.Time{}
+	}
+}
+
+func (l *Limiter) exhausted(now time.Time) error {
+	switch {
+	case l.limits.Daily > 0 && l.daily >= l.limits.Daily:
+		return fmt.Errorf("%s: daily %w (%d calls)", l.name, ErrQuotaExhausted, l.limits.Daily)
+	case l.limits.Monthly > 0 && l.monthly >= l.limits.Monthly:
+		return fmt.Errorf("%s: monthly %w (%d calls)", l.name, ErrQuotaExhausted, l.limits.Monthly)
+	case l.remaining == 0:
+		return fmt.Errorf("%s: %w until %s", l.name, ErrQuotaExhausted, l.resetAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Observe reads a response's rate-limit headers: the de-facto
+// X-RateLimit-Remaining / X-RateLimit-Reset, RapidAPI's
+// X-RateLimit-Requests-* and the draft standard RateLimit-*. Reset may be
+// seconds from now, a Unix timestamp or an HTTP date.
+func (l *Limiter) Observe(h http.Header) {
+	v := firstHeader(h, "X-RateLimit-Requests-Remaining", "X-RateLimit-Remaining", "RateLimit-Remaining")
+	remaining, err := strconv.Atoi(v)
+	if err != nil || remaining < 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.remaining = remaining
+	l.resetAt = parseReset(firstHeader(h, "X-RateLimit-Requests-Reset", "X-RateLimit-Reset", "RateLimit-Reset"), now)
+	if remaining == 0 && l.resetAt.IsZero() {
+		l.resetAt = now.Add(defaultQuotaPause)
+	}
+	l.tokens = min(l.tokens, float64(remaining))
+}
+
+func firstHeader(h http.Header, names ...string) string {
+	for _, n := range names {
+		if v := h.Get(n); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseReset turns a reset header into an instant; zero when absent or
+// unreadable.
+func parseReset(v string, now time.Time) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n > 1_000_000_000 { // a Unix timestamp rather than a delay
+			return time.Unix(n, 0)
+		}
+		return now.Add(time.Duration(max(n, 0)) * time.Second)
+	}
+	if d := parseRetryAfter(v, now); d > 0 {
+		return now.Add(d)
+	}
+	return time.Time{}
+}
+
+// Usage reports the limiter's settings and counters.
+func (l *Limiter) Usage() Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.rollover(now)
+	u := Usage{
+		Provider:     l.name,
+		RPS:          l.limits.RPS,
+		Burst:        l.limits.Burst,
+		Daily:        l.daily,
+		DailyLimit:   l.limits.Daily,
+		Monthly:      l.monthly,
+		MonthlyLimit: l.limits.Monthly,
+		Exhausted:    l.exhausted(now) != nil,
+	}
+	if l.remaining >= 0 {
+		remaining := l.remaining
+		u.Remaining = &remaining
+	}
+	if !l.resetAt.IsZero() {
+		reset := l.resetAt
+		u.ResetAt = &reset
+	}
+	return u
+}
+
+// Client returns a copy of base whose requests wait for the limiter and
+// whose responses feed Observe.
+func (l *Limiter) Client(base *http.Client) *http.Client {
+	c := *base
+	next := c.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.Transport = limitedTransport{next: next, limiter: l}
+	return &c
+}
+
+type limitedTransport struct {
+	next    http.RoundTripper
+	limiter *Limiter
+}
+
+func (t limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.limiter.Observe(resp.Header)
+	}
+	return resp, err
+}
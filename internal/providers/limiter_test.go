@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/config"
+)
+
+func newTestLimiter(limits config.RateLimit) (*Limiter, *fakeClock, *[]time.Duration) {
+	clk := &fakeClock{t: time.Date(2025, 1, 31, 23, 59, 0, 0, time.UTC)}
+	var slept []time.Duration
+	l := NewLimiter("test", limits)
+	l.now = clk.now
+	l.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		clk.t = clk.t.Add(d)
+		return nil
+	}
+	return l, clk, &slept
+}
+
+func TestLimiter_TokenBucket(t *testing.T) {
+	l, _, slept := newTestLimiter(config.RateLimit{RPS: 2, Burst: 2})
+	ctx := context.Background()
+
+	require.NoError(t, l.Wait(ctx))
+	require.NoError(t, l.Wait(ctx))
+	require.Empty(t, *slept, "the burst is available at once")
+
+	require.NoError(t, l.Wait(ctx))
+	require.Equal(t, []time.Duration{500 * time.Millisecond}, *slept)
+	require.Equal(t, 3, l.Usage().Daily)
+}
+
+func TestLimiter_DefaultBurst(t *testing.T) {
+	require.Equal(t, 3, NewLimiter("x", config.RateLimit{RPS: 2.5}).limits.Burst)
+	require.Equal(t, 1, NewLimiter("x", config.RateLimit{RPS: 0.2}).limits.Burst)
+}
+
+func TestLimiter_WaitPastDeadlineIsRateLimited(t *testing.T) {
+	l, clk, slept := newTestLimiter(config.RateLimit{RPS: 1, Burst: 1})
+	require.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithDeadline(context.Background(), clk.t.Add(100*time.Millisecond))
+	defer cancel()
+	err := l.Wait(ctx)
+	require.ErrorIs(t, err, ErrRateLimited)
+	require.False(t, IsTransient(err))
+	require.Empty(t, *slept)
+}
+
+func TestLimiter_DailyAndMonthlyQuotas(t *testing.T) {
+	l, clk, _ := newTestLimiter(config.RateLimit{Daily: 2, Monthly: 3})
+	ctx := context.Background()
+
+	require.NoError(t, l.Wait(ctx))
+	require.NoError(t, l.Wait(ctx))
+	err := l.Wait(ctx)
+	require.ErrorIs(t, err, ErrQuotaExhausted)
+	require.False(t, IsTransient(err))
+	require.True(t, l.Usage().Exhausted)
+
+	// a new UTC day resets the daily counter; it is also a new month here
+	clk.t = clk.t.Add(2 * time.Minute)
+	require.False(t, l.Usage().Exhausted)
+	require.NoError(t, l.Wait(ctx))
+	require.NoError(t, l.Wait(ctx))
+
+	clk.t = clk.t.Add(24 * time.Hour)
+	require.NoError(t, l.Wait(ctx))
+	require.ErrorIs(t, l.Wait(ctx), ErrQuotaExhausted, "3 calls this month")
+	u := l.Usage()
+	require.Equal(t, 3, u.Monthly)
+	require.Equal(t, 1, u.Daily)
+}
+
+func TestLimiter_ObserveHeaders(t *testing.T) {
+	l, clk, _ := newTestLimiter(config.RateLimit{})
+	ctx := context.Background()
+
+	h := http.Header{}
+	h.Set("X-RateLimit-Requests-Remaining", "0")
+	h.Set("X-RateLimit-Requests-Reset", "30")
+	l.Observe(h)
+	require.ErrorIs(t, l.Wait(ctx), ErrQuotaExhausted)
+	u := l.Usage()
+	require.Equal(t, 0, *u.Remaining)
+	require.Equal(t, clk.t.Add(30*time.Second), *u.ResetAt)
+
+	clk.t = clk.t.Add(30 * time.Second)
+	require.NoError(t, l.Wait(ctx), "the provider's window was reset")
+	require.Nil(t, l.Usage().Remaining)
+}
+
+func TestLimiter_RemainingCapsBurst(t *testing.T) {
+	l, _, slept := newTestLimiter(config.RateLimit{RPS: 10, Burst: 10})
+	h := http.Header{}
+	h.Set("X-RateLimit-Remaining", "1")
+	l.Observe(h)
+
+	require.NoError(t, l.Wait(context.Background()))
+	require.ErrorIs(t, l.Wait(context.Background()), ErrQuotaExhausted, "the last reported request was used")
+	require.Empty(t, *slept)
+}
+
+func TestParseReset(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, now.Add(time.Minute), parseReset("60", now))
+	require.Equal(t, now.Add(time.Hour), parseReset(strconv.FormatInt(now.Add(time.Hour).Unix(), 10), now).UTC())
+	require.Equal(t, now.Add(2*time.Hour), parseReset(now.Add(2*time.Hour).Format(http.TimeFormat), now))
+	require.True(t, parseReset("soon", now).IsZero())
+}
+
+func TestLimiter_ClientStopsCallingWhenExhausted(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("X-RateLimit-Requests-Remaining", "0")
+		w.Header().Set("X-RateLimit-Requests-Reset", "3600")
+	}))
+	defer srv.Close()
+
+	l := NewLimiter("rapid-booking", config.RateLimit{})
+	c := l.Client(http.DefaultClient)
+
+	resp, err := c.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = c.Get(srv.URL)
+	require.ErrorIs(t, err, ErrQuotaExhausted)
+	require.False(t, IsTransient(err), "must not be retried or trip the breaker")
+	require.EqualValues(t, 1, calls.Load())
+}
+
+func TestResilient_IgnoresLimiterRefusals(t *testing.T) {
+	refused := fmt.Errorf("scripted: %w", ErrQuotaExhausted)
+	p := &scripted{errs: []error{refused, refused, refused}}
+	r, _, slept := newTestResilient(p, DefaultRetryPolicy, BreakerPolicy{FailureThreshold: 1, Cooldown: time.Minute})
+
+	_, err := r.Search(context.Background(), SearchRequest{})
+	require.ErrorIs(t, err, ErrQuotaExhausted)
+	require.Equal(t, 1, p.calls, "not retried")
+	require.Empty(t, *slept)
+	require.Equal(t, BreakerClosed, r.BreakerStatus().State)
+}
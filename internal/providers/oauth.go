@@ -0,0 +1,188 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// tokenLeeway is how long before expiry a cached token is replaced, at
+	// most a tenth of its lifetime.
+	tokenLeeway = 30 * time.Second
+	// tokenTimeout bounds a token fetch, which runs detached from the
+	// caller that triggered it.
+	tokenTimeout = 10 * time.Second
+)
+
+// ClientCredentials is an OAuth2 client-credentials token source. A token
+// is cached until shortly before it expires; concurrent callers that find
+// it missing or stale share a single fetch.
+type ClientCredentials struct {
+	op       string // names errors, e.g. "amadeus token"
+	tokenURL string
+	id       string
+	secret   string
+	client   *http.Client
+	now      func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time // zero when the server gave no expiry
+
+	fetch singleflight.Group
+}
+
+// NewClientCredentials fetches tokens from tokenURL with client, which
+// should not itself add credentials.
+func NewClientCredentials(name, tokenURL, id, secret string, client *http.Client) *ClientCredentials {
+	return &ClientCredentials{
+		op:       name + " token",
+		tokenURL: tokenURL,
+		id:       id,
+		secret:   secret,
+		client:   client,
+		now:      time.Now,
+	}
+}
+
+// Token returns the cached access token, fetching a new one when there is
+// none or it is about to expire. A caller whose ctx ends stops waiting; the
+// fetch itself carries on for the others.
+func (c *ClientCredentials) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	tok, refreshAt := c.token, c.refreshAt
+	c.mu.Unlock()
+	if tok != "" && (refreshAt.IsZero() || c.now().Before(refreshAt)) {
+		return tok, nil
+	}
+
+	ch := c.fetch.DoChan("token", func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tokenTimeout)
+		defer cancel()
+		return c.refresh(ctx)
+	})
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return "", r.Err
+		}
+		return r.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Invalidate drops tok if it is still the cached token, so the next Token
+// call fetches a fresh one. Passing the rejected token keeps a burst of
+// 401s from throwing away a token another caller just fetched.
+func (c *ClientCredentials) Invalidate(tok string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == tok {
+		c.token, c.refreshAt = "", time.Time{}
+	}
+}
+
+func (c *ClientCredentials) refresh(ctx context.Context) (string, error) {
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	data.Set("client_id", c.id)
+	data.Set("client_secret", c.secret)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", newStatusError(c.op, resp)
+	}
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", err
+	}
+	if tr.AccessToken == "" {
+		return "", errors.New(c.op + ": no access_token in response")
+	}
+
+	var refreshAt time.Time
+	if tr.ExpiresIn > 0 {
+		lifetime := time.Duration(tr.ExpiresIn) * time.Second
+		refreshAt = c.now().Add(lifetime - min(tokenLeeway, lifetime/10))
+	}
+	c.mu.Lock()
+	c.token, c.refreshAt = tr.AccessToken, refreshAt
+	c.mu.Unlock()
+	return tr.AccessToken, nil
+}
+
+// Client returns a copy of base that sends the bearer token with every
+// request. A 401 answer invalidates the token and the request is repeated
+// once with a freshly fetched one.
+func (c *ClientCredentials) Client(base *http.Client) *http.Client {
+	cl := *base
+	next := cl.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	cl.Transport = bearerTransport{next: next, tokens: c}
+	return &cl
+}
+
+type bearerTransport struct {
+	next   http.RoundTripper
+	tokens *ClientCredentials
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, tok, err := t.send(req, req.Body)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// the body was consumed; without a way to rebuild it the 401 stands
+	body := req.Body
+	if body != nil && body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		if body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	t.tokens.Invalidate(tok)
+	resp, _, err = t.send(req, body)
+	return resp, err
+}
+
+func (t bearerTransport) send(req *http.Request, body io.ReadCloser) (*http.Response, string, error) {
+	tok, err := t.tokens.Token(req.Context())
+	if err != nil {
+		if body != nil {
+			body.Close()
+		}
+		return nil, "", err
+	}
+	r := req.Clone(req.Context())
+	r.Body = body
+	r.Header.Set("Authorization", "Bearer "+tok)
+	resp, err := t.next.RoundTrip(r)
+	return resp, tok, err
+}
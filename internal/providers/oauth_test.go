@@ -0,0 +1,201 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/config"
+)
+
+// fakeOAuth issues tok-1, tok-2, … from /token and serves /api to the
+// latest token only, like a server that revoked the older ones.
+type fakeOAuth struct {
+	fetches   atomic.Int32
+	apiCalls  atomic.Int32
+	expiresIn int
+	delay     time.Duration
+	reject    bool // answer every API call with 401
+	bodies    []string
+	mu        sync.Mutex
+}
+
+func (f *fakeOAuth) handler(t *testing.T) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("client_secret") != "secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		time.Sleep(f.delay)
+		n := f.fetches.Add(1)
+		fmt.Fprintf(w, `{"access_token":"tok-%d","token_type":"Bearer","expires_in":%d}`, n, f.expiresIn)
+	})
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		f.apiCalls.Add(1)
+		b, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		f.bodies = append(f.bodies, string(b))
+		f.mu.Unlock()
+		if f.reject || r.Header.Get("Authorization") != fmt.Sprintf("Bearer tok-%d", f.fetches.Load()) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"data":[]}`)
+	})
+	return mux
+}
+
+func newFakeOAuth(t *testing.T, f *fakeOAuth) (*ClientCredentials, *httptest.Server) {
+	srv := httptest.NewServer(f.handler(t))
+	t.Cleanup(srv.Close)
+	return NewClientCredentials("test", srv.URL+"/token", "id", "secret", srv.Client()), srv
+}
+
+func TestClientCredentials_CachesUntilNearExpiry(t *testing.T) {
+	f := &fakeOAuth{expiresIn: 1800}
+	tokens, _ := newFakeOAuth(t, f)
+	clk := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tokens.now = clk.now
+	ctx := context.Background()
+
+	for range 3 {
+		tok, err := tokens.Token(ctx)
+		require.NoError(t, err)
+		require.Equal(t, "tok-1", tok)
+	}
+	require.EqualValues(t, 1, f.fetches.Load())
+
+	clk.t = clk.t.Add(1800*time.Second - tokenLeeway - time.Second)
+	tok, _ := tokens.Token(ctx)
+	require.Equal(t, "tok-1", tok, "still fresh")
+
+	clk.t = clk.t.Add(time.Second)
+	tok, _ = tokens.Token(ctx)
+	require.Equal(t, "tok-2", tok, "refreshed shortly before expiry")
+}
+
+func TestClientCredentials_ShortLivedTokenLeeway(t *testing.T) {
+	f := &fakeOAuth{expiresIn: 20}
+	tokens, _ := newFakeOAuth(t, f)
+	clk := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tokens.now = clk.now
+
+	_, err := tokens.Token(context.Background())
+	require.NoError(t, err)
+	clk.t = clk.t.Add(17 * time.Second)
+	_, _ = tokens.Token(context.Background())
+	require.EqualValues(t, 1, f.fetches.Load(), "leeway is a tenth of a short lifetime")
+}
+
+func TestClientCredentials_SingleRefreshUnderLoad(t *testing.T) {
+	f := &fakeOAuth{expiresIn: 1800, delay: 50 * time.Millisecond}
+	tokens, _ := newFakeOAuth(t, f)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tok, err := tokens.Token(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, "tok-1", tok)
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 1, f.fetches.Load())
+}
+
+func TestClientCredentials_CallerGivesUpFetchCarriesOn(t *testing.T) {
+	f := &fakeOAuth{expiresIn: 1800, delay: 100 * time.Millisecond}
+	tokens, _ := newFakeOAuth(t, f)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := tokens.Token(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	tok, err := tokens.Token(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "tok-1", tok)
+	require.EqualValues(t, 1, f.fetches.Load(), "the second caller joined the first fetch")
+}
+
+func TestClientCredentials_BadCredentials(t *testing.T) {
+	srv := httptest.NewServer((&fakeOAuth{}).handler(t))
+	defer srv.Close()
+	tokens := NewClientCredentials("test", srv.URL+"/token", "id", "wrong", srv.Client())
+
+	_, err := tokens.Token(context.Background())
+	var se *StatusError
+	require.ErrorAs(t, err, &se)
+	require.Equal(t, http.StatusUnauthorized, se.StatusCode)
+	require.Equal(t, "test token: 401 Unauthorized", err.Error())
+}
+
+func TestClientCredentials_RetriesUnauthorizedOnce(t *testing.T) {
+	f := &fakeOAuth{expiresIn: 1800}
+	tokens, srv := newFakeOAuth(t, f)
+	client := tokens.Client(srv.Client())
+
+	_, err := tokens.Token(context.Background())
+	require.NoError(t, err)
+	f.fetches.Add(1) // the server now only accepts a newer token than tok-1
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api", strings.NewReader(`{"q":1}`))
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.EqualValues(t, 2, f.apiCalls.Load())
+	require.Equal(t, []string{`{"q":1}`, `{"q":1}`}, f.bodies, "the body is sent again")
+
+	tok, _ := tokens.Token(context.Background())
+	require.Equal(t, "tok-3", tok)
+}
+
+func TestClientCredentials_PersistentUnauthorized(t *testing.T) {
+	f := &fakeOAuth{expiresIn: 1800, reject: true}
+	tokens, srv := newFakeOAuth(t, f)
+	client := tokens.Client(srv.Client())
+
+	resp, err := client.Get(srv.URL + "/api")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	require.EqualValues(t, 2, f.apiCalls.Load(), "retried once, not in a loop")
+	require.EqualValues(t, 2, f.fetches.Load())
+}
+
+func TestAmadeus_ReusesToken(t *testing.T) {
+	var fetches, searches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/security/oauth2/token":
+			fetches.Add(1)
+			fmt.Fprint(w, `{"access_token":"abc","expires_in":1799}`)
+		case "/v2/shopping/flight-offers":
+			searches.Add(1)
+			require.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+			fmt.Fprint(w, `{"data":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	a := NewAmadeus(&config.Config{AmadeusURL: srv.URL, AmadeusClientId: "id", AmadeusClientSSecret: "secret"})
+	for _, date := range []string{"2025-10-01", "2025-10-02", "2025-10-03"} {
+		_, err := a.Search(context.Background(), OneWay("AMS", "BCN", date).WithDefaults())
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, 3, searches.Load())
+	require.EqualValues(t, 1, fetches.Load())
+}
@@ -2,19 +2,329 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/you/go-jobsity-flights/internal/money"
 )
 
-type FlightOffer struct {
-	Provider    string    `json:"provider"`
-	Price       float64   `json:"price"`
-	Currency    string    `json:"currency"`
+// Slice is one leg of a journey. A one-way search has a single slice, a
+// return trip two (the second reversing the first), multi-city any number.
+type Slice struct {
+	Origin      string `json:"origin"`
+	Destination string `json:"destination"`
+	Date        string `json:"date"` // YYYY-MM-DD
+}
+
+type CabinClass string
+
+const (
+	CabinEconomy  CabinClass = "economy"
+	CabinPremium  CabinClass = "premium"
+	CabinBusiness CabinClass = "business"
+	CabinFirst    CabinClass = "first"
+)
+
+func (c CabinClass) Valid() bool {
+	switch c {
+	case CabinEconomy, CabinPremium, CabinBusiness, CabinFirst:
+		return true
+	}
+	return false
+}
+
+// Passengers is the party travelling. Infants travel on an adult's lap.
+type Passengers struct {
+	Adults   int `json:"adults"`
+	Children int `json:"children"`
+	Infants  int `json:"infants"`
+}
+
+const (
+	DefaultCurrency = "EUR"
+	MaxNearbyKm     = 300
+	maxPassengers   = 9
+)
+
+// SearchRequest is what every provider receives for a search.
+type SearchRequest struct {
+	Slices     []Slice    `json:"slices"`
+	Passengers Passengers `json:"passengers"`
+	Cabin      CabinClass `json:"cabin"`
+	Currency   string     `json:"currency"`
+	// NearbyKm widens every origin and destination to the airports within
+	// this distance; city codes (LON, NYC) always expand to their airports.
+	NearbyKm float64 `json:"nearby_km,omitempty"`
+	// MaxRoutes lowers how many airport combinations that expansion may
+	// search; 0 leaves the service's cap.
+	MaxRoutes int `json:"max_routes,omitempty"`
+}
+
+// WithDefaults fills unset options: one adult, economy, EUR.
+func (r SearchRequest) WithDefaults() SearchRequest {
+	if r.Passengers == (Passengers{}) {
+		r.Passengers.Adults = 1
+	}
+	if r.Cabin == "" {
+		r.Cabin = CabinEconomy
+	}
+	if r.Currency == "" {
+		r.Currency = DefaultCurrency
+	}
+	r.Currency = strings.ToUpper(r.Currency)
+	return r
+}
+
+func OneWay(origin, destination, date string) SearchRequest {
+	return SearchRequest{Slices: []Slice{{Origin: origin, Destination: destination, Date: date}}}
+}
+
+func RoundTrip(origin, destination, date, returnDate string) SearchRequest {
+	return SearchRequest{Slices: []Slice{
+		{Origin: origin, Destination: destination, Date: date},
+		{Origin: destination, Destination: origin, Date: returnDate},
+	}}
+}
+
+// IsRoundTrip reports whether the request is a plain return journey, which
+// most providers can express with a single "return date" parameter.
+func (r SearchRequest) IsRoundTrip() bool {
+	return len(r.Slices) == 2 &&
+		r.Slices[0].Origin == r.Slices[1].Destination &&
+		r.Slices[0].Destination == r.Slices[1].Origin
+}
+
+func (r SearchRequest) Validate() error {
+	if len(r.Slices) == 0 {
+		return errors.New("at least one slice is required")
+	}
+	for _, s := range r.Slices {
+		if s.Origin == "" || s.Destination == "" || s.Date == "" {
+			return errors.New("origin, destination and date are required")
+		}
+	}
+	p := r.Passengers
+	switch {
+	case p.Adults < 1:
+		return errors.New("at least one adult is required")
+	case p.Children < 0 || p.Infants < 0:
+		return errors.New("passenger counts cannot be negative")
+	case p.Infants > p.Adults:
+		return errors.New("each infant must travel with an adult")
+	case p.Adults+p.Children+p.Infants > maxPassengers:
+		return fmt.Errorf("at most %d passengers per search", maxPassengers)
+	}
+	if !r.Cabin.Valid() {
+		return fmt.Errorf("unknown cabin class %q (economy, premium, business, first)", r.Cabin)
+	}
+	if r.NearbyKm < 0 || r.NearbyKm > MaxNearbyKm {
+		return fmt.Errorf("nearby_km must be between 0 and %d", MaxNearbyKm)
+	}
+	if r.MaxRoutes < 0 {
+		return errors.New("max_routes cannot be negative")
+	}
+	if !isCurrencyCode(r.Currency) {
+		return fmt.Errorf("bad currency %q, use an ISO 4217 code", r.Currency)
+	}
+	return nil
+}
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Key identifies the request for caching purposes.
+func (r SearchRequest) Key() string {
+	parts := make([]string, 0, len(r.Slices))
+	for _, s := range r.Slices {
+		parts = append(parts, s.Origin+"|"+s.Destination+"|"+s.Date)
+	}
+	p := r.Passengers
+	key := strings.Join(parts, ";") + fmt.Sprintf("#%d/%d/%d|%s|%s", p.Adults, p.Children, p.Infants, r.Cabin, r.Currency)
+	if r.NearbyKm > 0 {
+		key += fmt.Sprintf("|~%g", r.NearbyKm)
+	}
+	if r.MaxRoutes > 0 {
+		key += fmt.Sprintf("|<%d", r.MaxRoutes)
+	}
+	return key
+}
+
+// Segment is a single flight (one take-off, one landing) within an itinerary.
+type Segment struct {
+	MarketingCarrier string    `json:"marketing_carrier"`
+	OperatingCarrier string    `json:"operating_carrier,omitempty"`
+	FlightNumber     string    `json:"flight_number"` // marketing designator, e.g. KL1675
+	Aircraft         string    `json:"aircraft,omitempty"`
+	Origin           string    `json:"origin"`
+	Destination      string    `json:"destination"`
+	DepartAt         time.Time `json:"depart_at"`
+	ArriveAt         time.Time `json:"arrive_at"`
+	DurationMin      int       `json:"duration_min"`
+	LayoverMin       int       `json:"layover_min,omitempty"` // ground time before the next segment
+}
+
+// MarshalJSON adds UTC instants next to the local wall times, which carry
+// the departure/arrival airport's offset.
+func (s Segment) MarshalJSON() ([]byte, error) {
+	type plain Segment
+	return json.Marshal(struct {
+		plain
+		utcTimes
+	}{plain(s), newUTCTimes(s.DepartAt, s.ArriveAt)})
+}
+
+// utcTimes is the UTC companion of a depart_at/arrive_at pair.
+type utcTimes struct {
+	DepartAtUTC time.Time `json:"depart_at_utc"`
+	ArriveAtUTC time.Time `json:"arrive_at_utc"`
+}
+
+func newUTCTimes(depart, arrive time.Time) utcTimes {
+	return utcTimes{DepartAtUTC: depart.UTC(), ArriveAtUTC: arrive.UTC()}
+}
+
+// Itinerary is the flown route for one slice of the request.
+type Itinerary struct {
+	Origin      string    `json:"origin"`
+	Destination string    `json:"destination"`
 	DurationMin int       `json:"duration_min"`
 	DepartAt    time.Time `json:"depart_at"`
 	ArriveAt    time.Time `json:"arrive_at"`
+	Stops       int       `json:"stops"`
+	Segments    []Segment `json:"segments,omitempty"`
+}
+
+func (it Itinerary) MarshalJSON() ([]byte, error) {
+	type plain Itinerary
+	return json.Marshal(struct {
+		plain
+		utcTimes
+	}{plain(it), newUTCTimes(it.DepartAt, it.ArriveAt)})
+}
+
+// newItinerary derives endpoints, stops and layovers from the segments.
+// durationMin is the provider's total when it reports one, otherwise 0 to
+// compute it from the first departure and last arrival. Segment times are
+// zone-aware instants, so computed durations are elapsed time even when a
+// flight crosses time zones.
+func newItinerary(segs []Segment, durationMin int) Itinerary {
+	for i := range segs {
+		if segs[i].DurationMin <= 0 {
+			segs[i].DurationMin = elapsedMinutes(segs[i].DepartAt, segs[i].ArriveAt)
+		}
+		if i < len(segs)-1 {
+			segs[i].LayoverMin = elapsedMinutes(segs[i].ArriveAt, segs[i+1].DepartAt)
+		}
+	}
+	first, last := segs[0], segs[len(segs)-1]
+	if durationMin <= 0 {
+		durationMin = elapsedMinutes(first.DepartAt, last.ArriveAt)
+	}
+	return Itinerary{
+		Origin:      first.Origin,
+		Destination: last.Destination,
+		DurationMin: durationMin,
+		DepartAt:    first.DepartAt,
+		ArriveAt:    last.ArriveAt,
+		Stops:       len(segs) - 1,
+		Segments:    segs,
+	}
+}
+
+// FlightOffer holds one itinerary per requested slice. DurationMin is the
+// total flying time across itineraries, DepartAt/ArriveAt span the journey.
+type FlightOffer struct {
+	// ID identifies the same offer across searches, so live streams can
+	// refer to it in their updates.
+	ID       string      `json:"id,omitempty"`
+	Provider string      `json:"provider"`
+	Price    money.Money `json:"price"`
+	// OriginalPrice keeps what the provider quoted when Price has been
+	// converted to the requested currency.
+	OriginalPrice *money.Money `json:"original_price,omitempty"`
+	DurationMin   int          `json:"duration_min"`
+	DepartAt      time.Time    `json:"depart_at"`
+	ArriveAt      time.Time    `json:"arrive_at"`
+	Stops         int          `json:"stops"`           // most stops on any itinerary
+	Route         string       `json:"route,omitempty"` // airports searched when a city or nearby search expanded, e.g. LGW-BCN
+	Itineraries   []Itinerary  `json:"itineraries,omitempty"`
+	// Sources lists every provider selling this exact itinerary when the
+	// same flights were returned more than once, cheapest first.
+	Sources []PriceSource `json:"sources,omitempty"`
+}
+
+func (o FlightOffer) MarshalJSON() ([]byte, error) {
+	type plain FlightOffer
+	return json.Marshal(struct {
+		plain
+		utcTimes
+	}{plain(o), newUTCTimes(o.DepartAt, o.ArriveAt)})
+}
+
+type PriceSource struct {
+	Provider string      `json:"provider"`
+	Price    money.Money `json:"price"`
+	Cheapest bool        `json:"cheapest,omitempty"`
+}
+
+// ProviderNames returns every provider offering o.
+func (o FlightOffer) ProviderNames() []string {
+	if len(o.Sources) == 0 {
+		return []string{o.Provider}
+	}
+	out := make([]string, 0, len(o.Sources))
+	for _, src := range o.Sources {
+		out = append(out, src.Provider)
+	}
+	return out
+}
+
+// Carriers lists the distinct marketing and operating carriers flown.
+func (o FlightOffer) Carriers() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, it := range o.Itineraries {
+		for _, sg := range it.Segments {
+			for _, c := range []string{sg.MarketingCarrier, sg.OperatingCarrier} {
+				if c != "" && !seen[c] {
+					seen[c] = true
+					out = append(out, c)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// withItineraries fills the journey-level fields of o from its itineraries.
+func (o FlightOffer) withItineraries(its []Itinerary) FlightOffer {
+	o.Itineraries = its
+	o.DurationMin = 0
+	o.Stops = 0
+	for _, it := range its {
+		o.DurationMin += it.DurationMin
+		o.Stops = max(o.Stops, it.Stops)
+	}
+	if len(its) > 0 {
+		o.DepartAt = its[0].DepartAt
+		o.ArriveAt = its[len(its)-1].ArriveAt
+	}
+	return o
 }
 
 type FlightProvider interface {
 	Name() string
-	Search(ctx context.Context, origin, destination, date string) ([]FlightOffer, error)
+	Search(ctx context.Context, req SearchRequest) ([]FlightOffer, error)
 }
@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/money"
 	"net/http"
 	"net/url"
-	"time"
+	"strconv"
+	"strings"
 )
 
 type RapidBooking struct {
@@ -15,13 +17,16 @@ type RapidBooking struct {
 	path        string
 	rapidApiKey string
 	client      *http.Client
+	limiter     *Limiter
 }
 
 func NewRapidBooking(cfg *config.Config) *RapidBooking {
+	limiter := NewLimiter("rapid-booking", cfg.RateLimits["rapid-booking"])
 	return &RapidBooking{host: cfg.RapidBookingHost,
 		path:        "/api/v1/flights/searchFlights",
 		rapidApiKey: cfg.RapidBookingRapidApiKey,
-		client:      http.DefaultClient,
+		client:      limiter.Client(http.DefaultClient),
+		limiter:     limiter,
 	}
 }
 
@@ -29,10 +34,18 @@ func (r *RapidBooking) Name() string {
 	return "rapid-booking"
 }
 
-func (r *RapidBooking) Search(ctx context.Context, origin, destination, date string) ([]FlightOffer, error) {
+// Usage reports the rate limiter and quota counters of this provider.
+func (r *RapidBooking) Usage() Usage { return r.limiter.Usage() }
+
+func (r *RapidBooking) Search(ctx context.Context, sr SearchRequest) ([]FlightOffer, error) {
 	if r.rapidApiKey == "" {
 		return nil, fmt.Errorf("rapid booking: missing API key")
 	}
+	// searchFlights only knows one-way and return journeys
+	if len(sr.Slices) != 1 && !sr.IsRoundTrip() {
+		return nil, fmt.Errorf("rapid booking: multi-city search not supported")
+	}
+	first := sr.Slices[0]
 
 	u := url.URL{
 		Scheme: "https",
@@ -41,16 +54,20 @@ func (r *RapidBooking) Search(ctx context.Context, origin, destination, date str
 	}
 	q := u.Query()
 	// Rapid requires the “.AIRPORT” suffix
-	q.Set("fromId", origin+".AIRPORT")
-	q.Set("toId", destination+".AIRPORT")
-	q.Set("departDate", date) // YYYY-MM-DD
-	q.Set("stops", "none")    // only direct to keep parsing simple/fastest
+	q.Set("fromId", first.Origin+".AIRPORT")
+	q.Set("toId", first.Destination+".AIRPORT")
+	q.Set("departDate", first.Date) // YYYY-MM-DD
+	if sr.IsRoundTrip() {
+		q.Set("returnDate", sr.Slices[1].Date)
+	}
 	q.Set("pageNo", "1")
-	q.Set("adults", "1")
-	q.Set("children", "0") // change if you want kids/infants
+	q.Set("adults", strconv.Itoa(sr.Passengers.Adults))
+	if ages := rapidChildrenAges(sr.Passengers); ages != "" {
+		q.Set("children", ages)
+	}
 	q.Set("sort", "BEST")
-	q.Set("cabinClass", "ECONOMY")
-	q.Set("currency_code", "EUR")
+	q.Set("cabinClass", rapidCabin(sr.Cabin))
+	q.Set("currency_code", sr.Currency)
 	u.RawQuery = q.Encode()
 
 	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
@@ -63,16 +80,35 @@ func (r *RapidBooking) Search(ctx context.Context, origin, destination, date str
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("rapid booking: %s", resp.Status)
+		return nil, newStatusError("rapid booking", resp)
 	}
 
 	var payload struct {
 		Data struct {
 			FlightOffers []struct {
+				// Booking.com returns one "segment" per requested slice, the
+				// individual flights are its "legs"
 				Segments []struct {
-					DepartureTime string `json:"departureTime"`
-					ArrivalTime   string `json:"arrivalTime"`
-					TotalTime     int    `json:"totalTime"`
+					DepartureAirport rapidAirport `json:"departureAirport"`
+					ArrivalAirport   rapidAirport `json:"arrivalAirport"`
+					DepartureTime    string       `json:"departureTime"`
+					ArrivalTime      string       `json:"arrivalTime"`
+					TotalTime        int          `json:"totalTime"`
+					Legs             []struct {
+						DepartureAirport rapidAirport `json:"departureAirport"`
+						ArrivalAirport   rapidAirport `json:"arrivalAirport"`
+						DepartureTime    string       `json:"departureTime"`
+						ArrivalTime      string       `json:"arrivalTime"`
+						TotalTime        int          `json:"totalTime"`
+						FlightInfo       struct {
+							FlightNumber int    `json:"flightNumber"`
+							PlaneType    string `json:"planeType"`
+							CarrierInfo  struct {
+								MarketingCarrier string `json:"marketingCarrier"`
+								OperatingCarrier string `json:"operatingCarrier"`
+							} `json:"carrierInfo"`
+						} `json:"flightInfo"`
+					} `json:"legs"`
 				} `json:"segments"`
 				PriceBreakdown struct {
 					Total struct {
@@ -94,45 +130,77 @@ func (r *RapidBooking) Search(ctx context.Context, origin, destination, date str
 		return nil, fmt.Errorf("rapid booking: %s", payload.Message)
 	}
 
-	fmt.Println(payload)
-
 	var out []FlightOffer
 	for _, fo := range payload.Data.FlightOffers {
 		if len(fo.Segments) == 0 {
 			continue
 		}
-		seg := fo.Segments[0]
-
-		dep := parseRapidTime(seg.DepartureTime)
-		arr := parseRapidTime(seg.ArrivalTime)
-
-		durMin := seg.TotalTime / 60
-		if durMin <= 0 && !dep.IsZero() && !arr.IsZero() {
-			durMin = int(arr.Sub(dep).Minutes())
+		its := make([]Itinerary, 0, len(fo.Segments))
+		for _, seg := range fo.Segments {
+			segs := make([]Segment, 0, len(seg.Legs))
+			for _, leg := range seg.Legs {
+				ci := leg.FlightInfo.CarrierInfo
+				segs = append(segs, Segment{
+					MarketingCarrier: ci.MarketingCarrier,
+					OperatingCarrier: ci.OperatingCarrier,
+					FlightNumber:     ci.MarketingCarrier + strconv.Itoa(leg.FlightInfo.FlightNumber),
+					Aircraft:         leg.FlightInfo.PlaneType,
+					Origin:           leg.DepartureAirport.Code,
+					Destination:      leg.ArrivalAirport.Code,
+					DepartAt:         airportTime(leg.DepartureTime, leg.DepartureAirport.Code),
+					ArriveAt:         airportTime(leg.ArrivalTime, leg.ArrivalAirport.Code),
+					DurationMin:      leg.TotalTime / 60,
+				})
+			}
+			if len(segs) == 0 {
+				// no leg detail, treat the whole slice as one flight
+				segs = append(segs, Segment{
+					Origin:      seg.DepartureAirport.Code,
+					Destination: seg.ArrivalAirport.Code,
+					DepartAt:    airportTime(seg.DepartureTime, seg.DepartureAirport.Code),
+					ArriveAt:    airportTime(seg.ArrivalTime, seg.ArrivalAirport.Code),
+					DurationMin: seg.TotalTime / 60,
+				})
+			}
+			its = append(its, newItinerary(segs, seg.TotalTime/60))
 		}
 
-		total := float64(fo.PriceBreakdown.Total.Units) +
-			float64(fo.PriceBreakdown.Total.Nanos)/1e9
+		pt := fo.PriceBreakdown.Total
+		currency := pt.CurrencyCode
+		if currency == "" {
+			currency = sr.Currency
+		}
+		total := money.FromUnitsNanos(pt.Units, pt.Nanos, currency)
 
 		out = append(out, FlightOffer{
-			Provider:    r.Name(),
-			Price:       total,
-			Currency:    fo.PriceBreakdown.Total.CurrencyCode,
-			DurationMin: durMin,
-			DepartAt:    dep,
-			ArriveAt:    arr,
-		})
+			Provider: r.Name(),
+			Price:    total,
+		}.withItineraries(its))
 	}
 
 	return out, nil
 }
 
-func parseRapidTime(s string) time.Time {
-	if t, err := time.Parse(time.RFC3339, s); err == nil {
-		return t
+// rapidChildrenAges renders children and infants as the comma separated age
+// list Booking.com expects. We don't collect ages, so use representative ones.
+func rapidChildrenAges(p Passengers) string {
+	ages := make([]string, 0, p.Children+p.Infants)
+	for range p.Children {
+		ages = append(ages, "10")
+	}
+	for range p.Infants {
+		ages = append(ages, "0")
 	}
-	if t, err := time.Parse("2006-01-02T15:04:05", s); err == nil {
-		return t.UTC()
+	return strings.Join(ages, ",")
+}
+
+func rapidCabin(c CabinClass) string {
+	if c == CabinPremium {
+		return "PREMIUM_ECONOMY"
 	}
-	return time.Time{}
+	return strings.ToUpper(string(c))
+}
+
+type rapidAirport struct {
+	Code string `json:"code"`
 }
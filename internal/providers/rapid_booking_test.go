@@ -0,0 +1,131 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/money"
+)
+
+// rapidOffers is a trimmed searchFlights response: AMS-JFK via LHR with
+// leg detail, and a return segment that comes without legs.
+const rapidOffers = `{
+  "status": true,
+  "message": "Success",
+  "timestamp": 1727700000000,
+  "data": {
+    "flightOffers": [{
+      "token": "d6a1f_H4sIAAAAAAAA_",
+      "segments": [
+        {"departureAirport": {"type": "AIRPORT", "code": "AMS", "name": "Amsterdam Airport Schiphol"},
+         "arrivalAirport": {"type": "AIRPORT", "code": "JFK", "name": "John F. Kennedy International Airport"},
+         "departureTime": "2025-10-01T10:00:00", "arrivalTime": "2025-10-01T15:00:00", "totalTime": 39600,
+         "legs": [
+          {"departureAirport": {"code": "AMS"}, "arrivalAirport": {"code": "LHR"},
+           "departureTime": "2025-10-01T10:00:00", "arrivalTime": "2025-10-01T10:20:00", "totalTime": 4800,
+           "flightInfo": {"flightNumber": 1001, "planeType": "73H",
+                          "carrierInfo": {"operatingCarrier": "KL", "marketingCarrier": "KL"}}},
+          {"departureAirport": {"code": "LHR"}, "arrivalAirport": {"code": "JFK"},
+           "departureTime": "2025-10-01T12:00:00", "arrivalTime": "2025-10-01T15:00:00", "totalTime": 28800,
+           "flightInfo": {"flightNumber": 117, "planeType": "777",
+                          "carrierInfo": {"operatingCarrier": "AA", "marketingCarrier": "BA"}}}
+        ]},
+        {"departureAirport": {"code": "JFK"}, "arrivalAirport": {"code": "AMS"},
+         "departureTime": "2025-10-08T18:00:00", "arrivalTime": "2025-10-09T07:50:00", "totalTime": 28200,
+         "legs": []}
+      ],
+      "priceBreakdown": {"total": {"currencyCode": "EUR", "units": 512, "nanos": 300000000}}
+    }]
+  }
+}`
+
+// newFakeRapid points a RapidBooking at a TLS test server, since the
+// adapter always speaks https.
+func newFakeRapid(t *testing.T, h http.HandlerFunc) *RapidBooking {
+	srv := httptest.NewTLSServer(h)
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	r := NewRapidBooking(&config.Config{RapidBookingHost: u.Host, RapidBookingRapidApiKey: "key"})
+	r.client = r.limiter.Client(srv.Client())
+	return r
+}
+
+func TestRapidBooking_RoundTrip(t *testing.T) {
+	r := newFakeRapid(t, func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/api/v1/flights/searchFlights", req.URL.Path)
+		require.Equal(t, "key", req.Header.Get("X-RapidAPI-Key"))
+		q := req.URL.Query()
+		require.Equal(t, "AMS.AIRPORT", q.Get("fromId"))
+		require.Equal(t, "JFK.AIRPORT", q.Get("toId"))
+		require.Equal(t, "2025-10-01", q.Get("departDate"))
+		require.Equal(t, "2025-10-08", q.Get("returnDate"))
+		require.Equal(t, "2", q.Get("adults"))
+		require.Equal(t, "10,10,0", q.Get("children"))
+		require.Equal(t, "PREMIUM_ECONOMY", q.Get("cabinClass"))
+		require.Equal(t, "EUR", q.Get("currency_code"))
+		fmt.Fprint(w, rapidOffers)
+	})
+
+	req := RoundTrip("AMS", "JFK", "2025-10-01", "2025-10-08")
+	req.Passengers = Passengers{Adults: 2, Children: 2, Infants: 1}
+	req.Cabin = CabinPremium
+	offers, err := r.Search(context.Background(), req.WithDefaults())
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+
+	o := offers[0]
+	price, _ := money.Parse("512.30", "EUR")
+	require.Equal(t, "rapid-booking", o.Provider)
+	require.Equal(t, price, o.Price)
+	require.Equal(t, 660+470, o.DurationMin)
+
+	out := o.Itineraries[0]
+	require.Equal(t, 1, out.Stops)
+	require.Len(t, out.Segments, 2)
+	require.Equal(t, Segment{
+		MarketingCarrier: "BA", OperatingCarrier: "AA", FlightNumber: "BA117", Aircraft: "777",
+		Origin: "LHR", Destination: "JFK",
+		DepartAt:    airportTime("2025-10-01T12:00:00", "LHR"),
+		ArriveAt:    airportTime("2025-10-01T15:00:00", "JFK"),
+		DurationMin: 480,
+	}, out.Segments[1])
+	require.Equal(t, 100, out.Segments[0].LayoverMin)
+
+	// no legs: the segment itself stands in as one flight
+	back := o.Itineraries[1]
+	require.Zero(t, back.Stops)
+	require.Len(t, back.Segments, 1)
+	require.Equal(t, "JFK", back.Segments[0].Origin)
+	require.Equal(t, 470, back.Segments[0].DurationMin)
+}
+
+func TestRapidBooking_OneWayHasNoReturnDate(t *testing.T) {
+	r := newFakeRapid(t, func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		require.False(t, q.Has("returnDate"))
+		require.False(t, q.Has("children"))
+		fmt.Fprint(w, `{"status":true,"data":{"flightOffers":[]}}`)
+	})
+	offers, err := r.Search(context.Background(), OneWay("AMS", "BCN", "2025-10-01").WithDefaults())
+	require.NoError(t, err)
+	require.Empty(t, offers)
+}
+
+func TestRapidBooking_PriceWithoutCurrencyIsInTheRequestedOne(t *testing.T) {
+	r := newFakeRapid(t, func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, strings.Replace(rapidOffers, `"currencyCode": "EUR"`, `"currencyCode": ""`, 1))
+	})
+	req := RoundTrip("AMS", "JFK", "2025-10-01", "2025-10-08")
+	req.Currency = "USD"
+	offers, err := r.Search(context.Background(), req.WithDefaults())
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+	require.Equal(t, money.FromUnitsNanos(512, 300000000, "USD"), offers[0].Price)
+}
@@ -0,0 +1,177 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling a provider whose breaker is
+// open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// RetryPolicy controls how often a transient failure is retried.
+type RetryPolicy struct {
+	MaxAttempts int           // including the first call; 1 disables retries
+	BaseDelay   time.Duration // backoff before the second attempt, doubled after
+	MaxDelay    time.Duration // cap for the backoff and for Retry-After hints
+}
+
+// BreakerPolicy controls when a provider is taken out of rotation.
+type BreakerPolicy struct {
+	FailureThreshold int           // consecutive transient failures that open the breaker
+	Cooldown         time.Duration // how long it stays open before a probe
+}
+
+var (
+	DefaultRetryPolicy   = RetryPolicy{MaxAttempts: 3, BaseDelay: 200 * time.Millisecond, MaxDelay: 2 * time.Second}
+	DefaultBreakerPolicy = BreakerPolicy{FailureThreshold: 5, Cooldown: 30 * time.Second}
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerStatus is a snapshot of a provider's circuit breaker.
+type BreakerStatus struct {
+	Provider            string     `json:"provider"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"` // when an open breaker lets a probe through
+}
+
+// Resilient wraps a provider with retries and a circuit breaker. Only
+// transient failures (see IsTransient) are retried and counted; once
+// FailureThreshold of them happen in a row the breaker opens and calls fail
+// fast with ErrCircuitOpen for Cooldown. Then a single probe call is let
+// through (half-open): success closes the breaker, failure reopens it.
+type Resilient struct {
+	FlightProvider
+	retry   RetryPolicy
+	breaker BreakerPolicy
+	now     func() time.Time
+	sleep   func(ctx context.Context, d time.Duration) error
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewResilient(p FlightProvider, retry RetryPolicy, breaker BreakerPolicy) *Resilient {
+	return &Resilient{
+		FlightProvider: p,
+		retry:          retry,
+		breaker:        breaker,
+		now:            time.Now,
+		sleep:          sleepCtx,
+		state:          BreakerClosed,
+	}
+}
+
+func (r *Resilient) Search(ctx context.Context, req SearchRequest) ([]FlightOffer, error) {
+	for attempt := 1; ; attempt++ {
+		if !r.allow() {
+			return nil, fmt.Errorf("%s: %w", r.Name(), ErrCircuitOpen)
+		}
+		offers, err := r.FlightProvider.Search(ctx, req)
+		r.record(err)
+		if err == nil || !IsTransient(err) || attempt >= r.retry.MaxAttempts {
+			return offers, err
+		}
+		delay := r.backoff(attempt, err)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return nil, err // the next attempt could not finish in time anyway
+		}
+		if r.sleep(ctx, delay) != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff is full-jitter exponential backoff, replaced by the server's
+// Retry-After hint when it sent one.
+func (r *Resilient) backoff(attempt int, err error) time.Duration {
+	var se *StatusError
+	if errors.As(err, &se) && se.RetryAfter > 0 {
+		return min(se.RetryAfter, r.retry.MaxDelay)
+	}
+	ceiling := min(r.retry.BaseDelay<<(attempt-1), r.retry.MaxDelay)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
+
+func (r *Resilient) allow() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.state {
+	case BreakerOpen:
+		if r.now().Sub(r.openedAt) < r.breaker.Cooldown {
+			return false
+		}
+		r.state = BreakerHalfOpen
+		fallthrough
+	case BreakerHalfOpen:
+		if r.probing {
+			return false
+		}
+		r.probing = true
+	}
+	return true
+}
+
+func (r *Resilient) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	wasProbe := r.state == BreakerHalfOpen
+	r.probing = false
+	switch {
+	case err == nil:
+		r.state, r.failures = BreakerClosed, 0
+	case IsTransient(err):
+		r.failures++
+		if wasProbe || (r.breaker.FailureThreshold > 0 && r.failures >= r.breaker.FailureThreshold) {
+			r.state, r.openedAt = BreakerOpen, r.now()
+		}
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrQuotaExhausted), errors.Is(err, ErrRateLimited):
+		// the provider was never asked; a half-open breaker awaits the next probe
+	case wasProbe:
+		// a non-transient answer still proves the provider is reachable
+		r.state, r.failures = BreakerClosed, 0
+	}
+}
+
+// Unwrap returns the wrapped provider.
+func (r *Resilient) Unwrap() FlightProvider { return r.FlightProvider }
+
+// BreakerStatus reports the current breaker state.
+func (r *Resilient) BreakerStatus() BreakerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := BreakerStatus{Provider: r.Name(), State: r.state, ConsecutiveFailures: r.failures}
+	if r.state != BreakerClosed {
+		opened, retry := r.openedAt, r.openedAt.Add(r.breaker.Cooldown)
+		st.OpenedAt, st.RetryAt = &opened, &retry
+	}
+	return st
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
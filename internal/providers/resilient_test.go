@@ -0,0 +1,175 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scripted returns the queued errors one call at a time, then succeeds.
+type scripted struct {
+	errs  []error
+	calls int
+}
+
+func (s *scripted) Name() string { return "scripted" }
+
+func (s *scripted) Search(context.Context, SearchRequest) ([]FlightOffer, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	return []FlightOffer{{Provider: "scripted"}}, nil
+}
+
+func unavailable() error {
+	return &StatusError{Op: "scripted", StatusCode: 503, Status: "503 Service Unavailable"}
+}
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestResilient(p FlightProvider, retry RetryPolicy, br BreakerPolicy) (*Resilient, *fakeClock, *[]time.Duration) {
+	clk := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var slept []time.Duration
+	r := NewResilient(p, retry, br)
+	r.now = clk.now
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	return r, clk, &slept
+}
+
+func TestResilient_RetriesTransientFailures(t *testing.T) {
+	p := &scripted{errs: []error{unavailable(), unavailable()}}
+	r, _, slept := newTestResilient(p, RetryPolicy{MaxAttempts: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, DefaultBreakerPolicy)
+
+	offers, err := r.Search(context.Background(), SearchRequest{})
+	require.NoError(t, err)
+	require.Len(t, offers, 1)
+	require.Equal(t, 3, p.calls)
+	require.Len(t, *slept, 2)
+	require.LessOrEqual(t, (*slept)[0], 100*time.Millisecond)
+	require.LessOrEqual(t, (*slept)[1], 200*time.Millisecond)
+	require.Equal(t, BreakerClosed, r.BreakerStatus().State)
+	require.Zero(t, r.BreakerStatus().ConsecutiveFailures)
+}
+
+func TestResilient_DoesNotRetryPermanentErrors(t *testing.T) {
+	for _, err := range []error{
+		&StatusError{Op: "scripted", StatusCode: 400, Status: "400 Bad Request"},
+		errors.New("rapid booking: multi-city search not supported"),
+	} {
+		p := &scripted{errs: []error{err}}
+		r, _, _ := newTestResilient(p, DefaultRetryPolicy, BreakerPolicy{FailureThreshold: 1, Cooldown: time.Minute})
+
+		_, got := r.Search(context.Background(), SearchRequest{})
+		require.Equal(t, err, got)
+		require.Equal(t, 1, p.calls)
+		require.Equal(t, BreakerClosed, r.BreakerStatus().State)
+	}
+}
+
+func TestResilient_HonoursRetryAfter(t *testing.T) {
+	limited := &StatusError{Op: "scripted", StatusCode: 429, Status: "429 Too Many Requests", RetryAfter: 700 * time.Millisecond}
+	p := &scripted{errs: []error{limited}}
+	r, _, slept := newTestResilient(p, RetryPolicy{MaxAttempts: 2, BaseDelay: 10 * time.Millisecond, MaxDelay: time.Second}, DefaultBreakerPolicy)
+
+	_, err := r.Search(context.Background(), SearchRequest{})
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{700 * time.Millisecond}, *slept)
+}
+
+func TestResilient_GivesUpWhenBackoffExceedsDeadline(t *testing.T) {
+	limited := &StatusError{Op: "scripted", StatusCode: 429, Status: "429 Too Many Requests", RetryAfter: 2 * time.Second}
+	p := &scripted{errs: []error{limited}}
+	r, _, slept := newTestResilient(p, RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 5 * time.Second}, DefaultBreakerPolicy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err := r.Search(ctx, SearchRequest{})
+	require.Equal(t, limited, err)
+	require.Equal(t, 1, p.calls)
+	require.Empty(t, *slept)
+}
+
+func TestResilient_BreakerOpensAndHalfOpens(t *testing.T) {
+	p := &scripted{errs: []error{unavailable(), unavailable(), unavailable()}}
+	r, clk, _ := newTestResilient(p, RetryPolicy{MaxAttempts: 1}, BreakerPolicy{FailureThreshold: 2, Cooldown: 30 * time.Second})
+	ctx := context.Background()
+
+	_, _ = r.Search(ctx, SearchRequest{})
+	_, _ = r.Search(ctx, SearchRequest{})
+	st := r.BreakerStatus()
+	require.Equal(t, BreakerOpen, st.State)
+	require.Equal(t, clk.t.Add(30*time.Second), *st.RetryAt)
+
+	// open: fail fast without calling the provider
+	_, err := r.Search(ctx, SearchRequest{})
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.Equal(t, 2, p.calls)
+
+	// after the cooldown one probe goes through; it fails and reopens
+	clk.t = clk.t.Add(31 * time.Second)
+	_, err = r.Search(ctx, SearchRequest{})
+	require.ErrorContains(t, err, "503")
+	require.Equal(t, 3, p.calls)
+	require.Equal(t, BreakerOpen, r.BreakerStatus().State)
+
+	// the next probe succeeds and closes it
+	clk.t = clk.t.Add(31 * time.Second)
+	_, err = r.Search(ctx, SearchRequest{})
+	require.NoError(t, err)
+	require.Equal(t, BreakerClosed, r.BreakerStatus().State)
+	require.Nil(t, r.BreakerStatus().OpenedAt)
+}
+
+func TestResilient_HalfOpenAllowsSingleProbe(t *testing.T) {
+	r, clk, _ := newTestResilient(&scripted{}, RetryPolicy{MaxAttempts: 1}, BreakerPolicy{FailureThreshold: 1, Cooldown: time.Second})
+	r.record(unavailable())
+	clk.t = clk.t.Add(2 * time.Second)
+
+	require.True(t, r.allow())
+	require.Equal(t, BreakerHalfOpen, r.BreakerStatus().State)
+	require.False(t, r.allow(), "second caller must wait for the probe")
+
+	// a cancelled probe says nothing about the provider
+	r.record(context.Canceled)
+	require.Equal(t, BreakerHalfOpen, r.BreakerStatus().State)
+	require.True(t, r.allow())
+}
+
+func TestStatusErrorFromResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	se := newStatusError("duffel", resp)
+	require.Equal(t, "duffel: 429 Too Many Requests", se.Error())
+	require.Equal(t, 3*time.Second, se.RetryAfter)
+	require.True(t, IsTransient(se))
+	require.True(t, IsTransient(context.DeadlineExceeded))
+	require.False(t, IsTransient(context.Canceled))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	require.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	require.Equal(t, 90*time.Second, parseRetryAfter("Wed, 01 Jan 2025 12:01:30 GMT", now))
+	require.Zero(t, parseRetryAfter("Wed, 01 Jan 2025 11:00:00 GMT", now))
+	require.Zero(t, parseRetryAfter("soon", now))
+}
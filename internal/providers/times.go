@@ -0,0 +1,47 @@
+package providers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/airports"
+)
+
+// naiveLayouts are the offset-less timestamps providers send; they are wall
+// clock times at the airport.
+var naiveLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// parseAirportTime resolves a provider timestamp in the time zone of the
+// airport it refers to. Naive local times are read as that airport's wall
+// clock; timestamps carrying an offset keep their instant and are shown in
+// the airport's zone. Unknown airports fall back to UTC.
+func parseAirportTime(s, airport string) (time.Time, error) {
+	loc := airports.Default().Location(airport)
+	for _, layout := range []string{time.RFC3339Nano, time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.In(loc), nil
+		}
+	}
+	for _, layout := range naiveLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unsupported time format: %q", s)
+}
+
+// airportTime is parseAirportTime for callers that treat an unparseable
+// time as unknown.
+func airportTime(s, airport string) time.Time {
+	t, _ := parseAirportTime(s, airport)
+	return t
+}
+
+// elapsedMinutes is the flown time between two instants in different zones,
+// 0 when either is unknown.
+func elapsedMinutes(depart, arrive time.Time) int {
+	if depart.IsZero() || arrive.IsZero() {
+		return 0
+	}
+	return int(arrive.Sub(depart).Minutes())
+}
@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAirportTime(t *testing.T) {
+	// naive Amadeus/Rapid style: wall clock at the airport
+	got, err := parseAirportTime("2025-10-01T08:45:00", "AMS")
+	require.NoError(t, err)
+	require.Equal(t, "2025-10-01T08:45:00+02:00", got.Format(time.RFC3339))
+	require.Equal(t, "Europe/Amsterdam", got.Location().String())
+
+	// with an offset: same instant, shown in the airport's zone
+	got, err = parseAirportTime("2025-10-01T06:45:00Z", "JFK")
+	require.NoError(t, err)
+	require.Equal(t, "2025-10-01T02:45:00-04:00", got.Format(time.RFC3339))
+
+	// unknown airport falls back to UTC
+	got, err = parseAirportTime("2025-10-01T08:45", "QQQ")
+	require.NoError(t, err)
+	require.Equal(t, time.UTC, got.Location())
+
+	_, err = parseAirportTime("yesterday", "AMS")
+	require.Error(t, err)
+}
+
+func TestNewItineraryAcrossTimeZones(t *testing.T) {
+	// AMS 10:00 → LHR 10:20 (local), LHR 12:00 → JFK 15:00 (local)
+	segs := []Segment{
+		{Origin: "AMS", Destination: "LHR",
+			DepartAt: airportTime("2025-10-01T10:00:00", "AMS"),
+			ArriveAt: airportTime("2025-10-01T10:20:00", "LHR")},
+		{Origin: "LHR", Destination: "JFK",
+			DepartAt: airportTime("2025-10-01T12:00:00", "LHR"),
+			ArriveAt: airportTime("2025-10-01T15:00:00", "JFK")},
+	}
+	it := newItinerary(segs, 0)
+
+	require.Equal(t, 80, it.Segments[0].DurationMin)
+	require.Equal(t, 100, it.Segments[0].LayoverMin)
+	require.Equal(t, 480, it.Segments[1].DurationMin)
+	require.Equal(t, 660, it.DurationMin)
+	require.Equal(t, 1, it.Stops)
+
+	// a reported duration wins
+	require.Equal(t, 665, newItinerary(segs, 665).DurationMin)
+}
+
+func TestSegmentJSONHasLocalAndUTC(t *testing.T) {
+	sg := Segment{
+		FlightNumber: "KL1001",
+		Origin:       "AMS",
+		Destination:  "LHR",
+		DepartAt:     airportTime("2025-10-01T10:00:00", "AMS"),
+		ArriveAt:     airportTime("2025-10-01T10:20:00", "LHR"),
+	}
+	b, err := json.Marshal(FlightOffer{}.withItineraries([]Itinerary{newItinerary([]Segment{sg}, 0)}))
+	require.NoError(t, err)
+
+	var got struct {
+		DepartAt    string `json:"depart_at"`
+		DepartAtUTC string `json:"depart_at_utc"`
+		Itineraries []struct {
+			ArriveAt    string `json:"arrive_at"`
+			ArriveAtUTC string `json:"arrive_at_utc"`
+			Segments    []struct {
+				FlightNumber string `json:"flight_number"`
+				DepartAt     string `json:"depart_at"`
+				DepartAtUTC  string `json:"depart_at_utc"`
+			} `json:"segments"`
+		} `json:"itineraries"`
+	}
+	require.NoError(t, json.Unmarshal(b, &got))
+	require.Equal(t, "2025-10-01T10:00:00+02:00", got.DepartAt)
+	require.Equal(t, "2025-10-01T08:00:00Z", got.DepartAtUTC)
+	require.Equal(t, "2025-10-01T10:20:00+01:00", got.Itineraries[0].ArriveAt)
+	require.Equal(t, "2025-10-01T09:20:00Z", got.Itineraries[0].ArriveAtUTC)
+	require.Equal(t, "KL1001", got.Itineraries[0].Segments[0].FlightNumber)
+	require.Equal(t, "2025-10-01T08:00:00Z", got.Itineraries[0].Segments[0].DepartAtUTC)
+
+	// decoding ignores the derived UTC fields
+	var back FlightOffer
+	require.NoError(t, json.Unmarshal(b, &back))
+	require.True(t, back.DepartAt.Equal(sg.DepartAt))
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/cache"
+)
+
+// DefaultCacheEntries bounds the result cache when none is configured.
+const DefaultCacheEntries = 10_000
+
+// CacheEntry is what the result cache holds: a search result, or the
+// error of a failed search when negative caching is on.
+type CacheEntry struct {
+	Result     SearchResult `json:"result"`
+	Error      string       `json:"error,omitempty"`
+	FetchedAt  time.Time    `json:"fetched_at"`
+	FreshUntil time.Time    `json:"fresh_until"`
+}
+
+func (e CacheEntry) err() error {
+	if e.Error == "" {
+		return nil
+	}
+	return errors.New(e.Error)
+}
+
+const (
+	SourceProviders = "providers"
+	SourceCache     = "cache"
+)
+
+// Freshness describes a search result: fetched from providers for this
+// call or served from the cache, how old it is and whether it was past
+// its TTL (stale, with a refresh under way).
+type Freshness struct {
+	Source string
+	Age    time.Duration
+	Stale  bool
+}
+
+// NewResultCache returns an LRU for search results holding at most
+// maxEntries results and, when maxBytes > 0, about that many bytes of
+// results measured by their JSON encoding.
+func NewResultCache(maxEntries int, maxBytes int64) *cache.LRU[CacheEntry] {
+	if maxBytes <= 0 {
+		// no need to pay for encoding every result
+		return cache.NewLRU[CacheEntry](maxEntries, 0, nil)
+	}
+	return cache.NewLRU(maxEntries, maxBytes, entrySize)
+}
+
+func entrySize(e CacheEntry) int {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// CacheStats reports the result cache counters.
+func (s *SearchService) CacheStats() cache.Stats {
+	return s.cache.Stats()
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/providers"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	DefaultCalendarConcurrency = 4
+	// MaxCalendarSearches caps one calendar request: a whole month one-way,
+	// or roughly a 7x7 round-trip matrix.
+	MaxCalendarSearches = 62
+	// MaxCalendarRoutes caps the airport combinations one calendar request
+	// searches in total, shared evenly by its searches, so that expanding
+	// city codes does not multiply a month of searches by MaxRoutes.
+	MaxCalendarRoutes = 2 * MaxCalendarSearches
+)
+
+// CalendarCell is the best a single date (or date pair) has to offer.
+type CalendarCell struct {
+	Date       string                 `json:"date"`
+	ReturnDate string                 `json:"return_date,omitempty"`
+	Cheapest   *providers.FlightOffer `json:"cheapest,omitempty"`
+	Fastest    *providers.FlightOffer `json:"fastest,omitempty"`
+	Partial    bool                   `json:"partial,omitempty"` // some airports or providers were not searched
+	Error      string                 `json:"error,omitempty"`
+}
+
+type CalendarRow struct {
+	Date    string         `json:"date"`
+	Returns []CalendarCell `json:"returns"`
+}
+
+// Calendar is a price grid: Days for one-way searches, Matrix (outbound
+// rows by return columns) for round trips.
+type Calendar struct {
+	Days     []CalendarCell `json:"days,omitempty"`
+	Matrix   []CalendarRow  `json:"matrix,omitempty"`
+	Cheapest *CalendarCell  `json:"cheapest,omitempty"`
+}
+
+// DateWindow lists the dates center±days, skipping any before today.
+func DateWindow(center string, days int) ([]string, error) {
+	c, err := time.Parse(time.DateOnly, center)
+	if err != nil {
+		return nil, fmt.Errorf("bad date %q, use YYYY-MM-DD", center)
+	}
+	return datesBetween(c.AddDate(0, 0, -days), c.AddDate(0, 0, days)), nil
+}
+
+// MonthDates lists every remaining date of a YYYY-MM month.
+func MonthDates(month string) ([]string, error) {
+	m, err := time.Parse("2006-01", month)
+	if err != nil {
+		return nil, fmt.Errorf("bad month %q, use YYYY-MM", month)
+	}
+	return datesBetween(m, m.AddDate(0, 1, -1)), nil
+}
+
+func datesBetween(from, to time.Time) []string {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	var out []string
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if d.Before(today) {
+			continue
+		}
+		out = append(out, d.Format(time.DateOnly))
+	}
+	return out
+}
+
+// Calendar runs one search per outbound date (and per return date when
+// returnDates is set, pairing only returns on or after the outbound) with
+// at most concurrency searches in flight. Each search goes through Search,
+// so cached dates cost nothing, and expands to at most its share of
+// MaxCalendarRoutes. Per-date failures are reported in the cell; an error
+// is only returned for an empty or oversized grid.
+func (s *SearchService) Calendar(ctx context.Context, base providers.SearchRequest, dates, returnDates []string, concurrency int) (Calendar, error) {
+	if len(base.Slices) == 0 {
+		return Calendar{}, errors.New("origin and destination are required")
+	}
+	if len(dates) == 0 {
+		return Calendar{}, errors.New("no dates to search")
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultCalendarConcurrency
+	}
+	origin, dest := base.Slices[0].Origin, base.Slices[0].Destination
+
+	var cal Calendar
+	var cells []*CalendarCell
+	if len(returnDates) == 0 {
+		cal.Days = make([]CalendarCell, len(dates))
+		for i, d := range dates {
+			cal.Days[i] = CalendarCell{Date: d}
+			cells = append(cells, &cal.Days[i])
+		}
+	} else {
+		cal.Matrix = make([]CalendarRow, len(dates))
+		for i, d := range dates {
+			row := CalendarRow{Date: d}
+			for _, rd := range returnDates {
+				if rd >= d {
+					row.Returns = append(row.Returns, CalendarCell{Date: d, ReturnDate: rd})
+				}
+			}
+			cal.Matrix[i] = row
+		}
+		for i := range cal.Matrix {
+			for j := range cal.Matrix[i].Returns {
+				cells = append(cells, &cal.Matrix[i].Returns[j])
+			}
+		}
+	}
+	if len(cells) > MaxCalendarSearches {
+		return Calendar{}, fmt.Errorf("calendar too large: %d searches, at most %d", len(cells), MaxCalendarSearches)
+	}
+
+	routes := max(MaxCalendarRoutes/len(cells), 1)
+	if base.MaxRoutes > 0 {
+		routes = min(routes, base.MaxRoutes)
+	}
+
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+	for _, c := range cells {
+		g.Go(func() error {
+			req := base
+			req.MaxRoutes = routes
+			if c.ReturnDate == "" {
+				req.Slices = providers.OneWay(origin, dest, c.Date).Slices
+			} else {
+				req.Slices = providers.RoundTrip(origin, dest, c.Date, c.ReturnDate).Slices
+			}
+			res, err := s.Search(ctx, req)
+			if err != nil {
+				c.Error = err.Error()
+				return nil
+			}
+			c.Cheapest, c.Fastest, c.Partial = &res.Cheapest, &res.Fastest, res.Partial
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for _, c := range cells {
+		if c.Cheapest != nil && (cal.Cheapest == nil || c.Cheapest.Price.Less(cal.Cheapest.Cheapest.Price)) {
+			cal.Cheapest = c
+		}
+	}
+	if cal.Cheapest != nil {
+		best := *cal.Cheapest
+		cal.Cheapest = &best
+	}
+	return cal, nil
+}
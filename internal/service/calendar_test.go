@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+// dayPricedProvider prices each departure date differently and records how
+// many searches ran at once.
+type dayPricedProvider struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	calls    int32
+	prices   map[string]float64
+}
+
+func (p *dayPricedProvider) Name() string { return "days" }
+
+func (p *dayPricedProvider) Search(ctx context.Context, req providers.SearchRequest) ([]providers.FlightOffer, error) {
+	atomic.AddInt32(&p.calls, 1)
+	p.mu.Lock()
+	p.inFlight++
+	p.peak = max(p.peak, p.inFlight)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.inFlight--
+		p.mu.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	price, ok := p.prices[req.Slices[0].Date]
+	if !ok {
+		return nil, nil
+	}
+	if len(req.Slices) == 2 {
+		price += p.prices[req.Slices[1].Date]
+	}
+	return []providers.FlightOffer{{Provider: "days", Price: eur(price), DurationMin: 100}}, nil
+}
+
+func TestCalendar_OneWayWindow(t *testing.T) {
+	center := time.Now().UTC().AddDate(0, 0, 10)
+	day := func(offset int) string { return center.AddDate(0, 0, offset).Format(time.DateOnly) }
+
+	prov := &dayPricedProvider{prices: map[string]float64{
+		day(-3): 140, day(-2): 120, day(-1): 95, day(0): 110, day(1): 180, day(3): 99,
+	}}
+	svc := NewSearchService([]providers.FlightProvider{prov}, 5*time.Second, time.Minute)
+
+	dates, err := DateWindow(day(0), 3)
+	require.NoError(t, err)
+	require.Len(t, dates, 7)
+
+	base := providers.OneWay("AMS", "BCN", day(0))
+	cal, err := svc.Calendar(context.Background(), base, dates, nil, 2)
+	require.NoError(t, err)
+	require.Len(t, cal.Days, 7)
+	require.Empty(t, cal.Matrix)
+	require.LessOrEqual(t, prov.peak, 2)
+
+	require.Equal(t, eur(95), cal.Days[2].Cheapest.Price)
+	require.Equal(t, "no offers found", cal.Days[5].Error)
+	require.Nil(t, cal.Days[5].Cheapest)
+	require.Equal(t, day(-1), cal.Cheapest.Date)
+
+	// a second pass is served from the cache
+	_, err = svc.Calendar(context.Background(), base, dates, nil, 2)
+	require.NoError(t, err)
+	require.Equal(t, int32(7+1), atomic.LoadInt32(&prov.calls), "only the failed date is searched again")
+}
+
+func TestCalendar_RoundTripMatrix(t *testing.T) {
+	start := time.Now().UTC().AddDate(0, 0, 20)
+	day := func(offset int) string { return start.AddDate(0, 0, offset).Format(time.DateOnly) }
+
+	prov := &dayPricedProvider{prices: map[string]float64{
+		day(0): 100, day(1): 80, day(2): 90, day(3): 60,
+	}}
+	svc := NewSearchService([]providers.FlightProvider{prov}, 5*time.Second, time.Minute)
+
+	out := []string{day(0), day(1), day(2)}
+	ret := []string{day(1), day(2), day(3)}
+	cal, err := svc.Calendar(context.Background(), providers.OneWay("AMS", "BCN", day(0)), out, ret, 0)
+	require.NoError(t, err)
+	require.Len(t, cal.Matrix, 3)
+	require.Len(t, cal.Matrix[0].Returns, 3)
+	require.Len(t, cal.Matrix[2].Returns, 2, "returns before the outbound are skipped")
+	require.Equal(t, eur(140), cal.Matrix[1].Returns[2].Cheapest.Price)
+	require.Equal(t, day(1), cal.Cheapest.Date)
+	require.Equal(t, day(3), cal.Cheapest.ReturnDate)
+
+	_, err = svc.Calendar(context.Background(), providers.OneWay("AMS", "BCN", day(0)), nil, nil, 0)
+	require.Error(t, err)
+}
+
+func TestDateWindowSkipsPast(t *testing.T) {
+	today := time.Now().UTC().Format(time.DateOnly)
+	dates, err := DateWindow(today, 2)
+	require.NoError(t, err)
+	require.Equal(t, today, dates[0])
+	require.Len(t, dates, 3)
+
+	_, err = DateWindow("2025/10/01", 1)
+	require.Error(t, err)
+}
+
+func TestCalendar_SharesARouteBudget(t *testing.T) {
+	p := &routeRecorder{}
+	svc := NewSearchService([]providers.FlightProvider{p}, 5*time.Second, time.Minute)
+
+	dates, err := MonthDates(time.Now().UTC().AddDate(0, 2, 0).Format("2006-01"))
+	require.NoError(t, err)
+	cal, err := svc.Calendar(context.Background(), providers.OneWay("LON", "NYC", dates[0]).WithDefaults(), dates, nil, 0)
+	require.NoError(t, err)
+
+	// a month of LON-NYC would be 18 routes a day without the budget
+	perDay := max(MaxCalendarRoutes/len(dates), 1)
+	require.Len(t, p.routes, perDay*len(dates))
+	require.LessOrEqual(t, len(p.routes), MaxCalendarRoutes)
+	for _, c := range cal.Days {
+		require.True(t, c.Partial)
+	}
+}
+
+func TestCalendar_SharesTheSearchCache(t *testing.T) {
+	p := &routeRecorder{}
+	svc := NewSearchService([]providers.FlightProvider{p}, 5*time.Second, time.Minute)
+
+	date := time.Now().UTC().AddDate(0, 1, 0).Format("2006-01-02")
+	req := providers.OneWay("LON", "BCN", date).WithDefaults()
+	_, err := svc.Search(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, p.routes, 6)
+
+	// the day's budget covers all six routes, so the cell is the same search
+	cal, err := svc.Calendar(context.Background(), req, []string{date}, nil, 0)
+	require.NoError(t, err)
+	require.Len(t, p.routes, 6)
+	require.False(t, cal.Days[0].Partial)
+	require.Equal(t, "LGW-BCN", cal.Days[0].Cheapest.Route)
+}
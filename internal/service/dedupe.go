@@ -0,0 +1,73 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+// itineraryKey identifies the physical flights of an offer: every segment's
+// flight number and local departure time. Offers without segment detail get
+// an empty key and are never merged.
+func itineraryKey(o providers.FlightOffer) string {
+	var b strings.Builder
+	for i, it := range o.Itineraries {
+		if len(it.Segments) == 0 {
+			return ""
+		}
+		if i > 0 {
+			b.WriteByte('/')
+		}
+		for j, sg := range it.Segments {
+			if sg.FlightNumber == "" || sg.DepartAt.IsZero() {
+				return ""
+			}
+			if j > 0 {
+				b.WriteByte('+')
+			}
+			// wall clock, so providers that disagree on the zone still match
+			b.WriteString(sg.FlightNumber + "@" + sg.DepartAt.Format("2006-01-02T15:04"))
+		}
+	}
+	return b.String()
+}
+
+// mergeOffers collapses offers for identical itineraries coming from
+// different providers into one, keeping the cheapest as the base offer and
+// listing every provider's price in Sources. Order of first appearance is kept.
+func mergeOffers(all []providers.FlightOffer) []providers.FlightOffer {
+	groups := make(map[string][]providers.FlightOffer)
+	var order []string
+	out := make([]providers.FlightOffer, 0, len(all))
+	for _, o := range all {
+		k := itineraryKey(o)
+		if k == "" {
+			out = append(out, o)
+			continue
+		}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], o)
+	}
+	for _, k := range order {
+		g := groups[k]
+		if len(g) == 1 {
+			out = append(out, g[0])
+			continue
+		}
+		sort.SliceStable(g, func(i, j int) bool { return g[i].Price.Less(g[j].Price) })
+		merged := g[0]
+		merged.Sources = make([]providers.PriceSource, 0, len(g))
+		for i, o := range g {
+			merged.Sources = append(merged.Sources, providers.PriceSource{
+				Provider: o.Provider,
+				Price:    o.Price,
+				Cheapest: i == 0,
+			})
+		}
+		out = append(out, merged)
+	}
+	return out
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+func segmentOffer(provider string, price float64, flight string, depart time.Time) providers.FlightOffer {
+	return providers.FlightOffer{
+		Provider:    provider,
+		Price:       eur(price),
+		DurationMin: 120,
+		DepartAt:    depart,
+		ArriveAt:    depart.Add(2 * time.Hour),
+		Itineraries: []providers.Itinerary{{
+			Origin:      "AMS",
+			Destination: "BCN",
+			DurationMin: 120,
+			DepartAt:    depart,
+			ArriveAt:    depart.Add(2 * time.Hour),
+			Segments: []providers.Segment{{
+				MarketingCarrier: flight[:2],
+				FlightNumber:     flight,
+				Origin:           "AMS",
+				Destination:      "BCN",
+				DepartAt:         depart,
+				ArriveAt:         depart.Add(2 * time.Hour),
+			}},
+		}},
+	}
+}
+
+func TestSearch_MergesIdenticalItineraries(t *testing.T) {
+	cfg := &config.Config{
+		SearchTimeout: 5 * time.Second,
+		CacheTTL:      5 * time.Second,
+	}
+	dep := time.Date(2025, 10, 1, 7, 30, 0, 0, time.UTC)
+	// same wall clock in another zone must still be recognised as the same flight
+	depLocal := time.Date(2025, 10, 1, 7, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+
+	p1 := ProviderMock{name: "amadeus", cfg: cfg, offers: []providers.FlightOffer{
+		segmentOffer("amadeus", 130, "KL1675", dep),
+		segmentOffer("amadeus", 90, "VY8302", dep.Add(4*time.Hour)),
+	}}
+	p2 := ProviderMock{name: "duffel", cfg: cfg, offers: []providers.FlightOffer{
+		segmentOffer("duffel", 118, "KL1675", depLocal),
+	}}
+	p3 := ProviderMock{name: "rapid-booking", cfg: cfg, offers: []providers.FlightOffer{
+		segmentOffer("rapid-booking", 125, "KL1675", dep),
+		{Provider: "rapid-booking", Price: eur(200), DurationMin: 100},
+	}}
+
+	svc := NewSearchService([]providers.FlightProvider{p1, p2, p3}, cfg.SearchTimeout, cfg.CacheTTL)
+	res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.Len(t, res.All, 3)
+
+	merged := res.All[1]
+	require.Equal(t, "duffel", merged.Provider)
+	require.Equal(t, eur(118), merged.Price)
+	require.Equal(t, []providers.PriceSource{
+		{Provider: "duffel", Price: eur(118), Cheapest: true},
+		{Provider: "rapid-booking", Price: eur(125)},
+		{Provider: "amadeus", Price: eur(130)},
+	}, merged.Sources)
+
+	// offers without segment detail are never merged
+	require.Empty(t, res.All[2].Sources)
+	require.Equal(t, 3, res.Providers[0].Offers+res.Providers[1].Offers)
+
+	// provider filters look at every source of a merged offer, and the
+	// cheapest allowed one prices it
+	out := Filter{Providers: []string{"amadeus"}}.Apply(res)
+	require.Len(t, out.All, 2)
+	out = Filter{ExcludeProviders: []string{"duffel", "rapid-booking"}}.Apply(res)
+	require.Len(t, out.All, 2)
+	require.Equal(t, "amadeus", out.All[1].Provider)
+	require.Equal(t, eur(130), out.All[1].Price)
+	require.Empty(t, out.All[1].Sources)
+
+	out = Filter{ExcludeProviders: []string{"duffel"}}.Apply(res)
+	require.Equal(t, "rapid-booking", out.All[1].Provider)
+	require.Equal(t, eur(125), out.All[1].Price)
+	require.Equal(t, []providers.PriceSource{
+		{Provider: "rapid-booking", Price: eur(125), Cheapest: true},
+		{Provider: "amadeus", Price: eur(130)},
+	}, out.All[1].Sources)
+
+	// a price limit is checked against the allowed price
+	limit := eur(120)
+	require.Len(t, Filter{MaxPrice: &limit}.Apply(res).All, 2)
+	require.Len(t, Filter{MaxPrice: &limit, ExcludeProviders: []string{"duffel"}}.Apply(res).All, 1)
+
+	// the cached result is left alone
+	require.Equal(t, "duffel", res.All[1].Provider)
+	require.Len(t, res.All[1].Sources, 3)
+}
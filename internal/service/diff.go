@@ -0,0 +1,128 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/money"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+// Message types on a live stream.
+const (
+	ChangeSnapshot  = "snapshot"
+	ChangeDelta     = "delta"
+	ChangeHeartbeat = "heartbeat" // polled again, nothing changed
+)
+
+// Change is one message of a live stream: the full result first, then only
+// what differs from the previous message. Seq grows by one per message, so
+// a gap tells the client it missed something and should resubscribe.
+type Change struct {
+	Seq      int64                   `json:"seq"`
+	Type     string                  `json:"type"`
+	Snapshot *SearchResult           `json:"snapshot,omitempty"`
+	Added    []providers.FlightOffer `json:"added,omitempty"`
+	Removed  []string                `json:"removed,omitempty"` // offer ids
+	Repriced []Reprice               `json:"repriced,omitempty"`
+	Cheapest *providers.FlightOffer  `json:"cheapest,omitempty"`
+	Fastest  *providers.FlightOffer  `json:"fastest,omitempty"`
+	// Partial and Providers are sent when a provider's status changed.
+	Partial   *bool            `json:"partial,omitempty"`
+	Providers []ProviderStatus `json:"providers,omitempty"`
+}
+
+// Reprice is an offer whose price moved.
+type Reprice struct {
+	ID   string      `json:"id"`
+	From money.Money `json:"from"`
+	To   money.Money `json:"to"`
+}
+
+// Differ turns the successive results of one subscription into a snapshot
+// followed by deltas. It is not safe for concurrent use.
+type Differ struct {
+	seq  int64
+	prev *SearchResult
+}
+
+// Next returns the message that brings a client from the previous result
+// to res.
+func (d *Differ) Next(res SearchResult) Change {
+	d.seq++
+	c := Change{Seq: d.seq, Type: ChangeDelta}
+	if d.prev == nil {
+		c.Type, c.Snapshot = ChangeSnapshot, &res
+		d.prev = &res
+		return c
+	}
+	prev := *d.prev
+	d.prev = &res
+
+	before := make(map[string]providers.FlightOffer, len(prev.All))
+	for _, o := range prev.All {
+		before[offerID(o)] = o
+	}
+	after := make(map[string]bool, len(res.All))
+	for _, o := range res.All {
+		id := offerID(o)
+		after[id] = true
+		p, ok := before[id]
+		switch {
+		case !ok:
+			c.Added = append(c.Added, o)
+		case p.Price != o.Price:
+			c.Repriced = append(c.Repriced, Reprice{ID: id, From: p.Price, To: o.Price})
+		}
+	}
+	for _, o := range prev.All {
+		if id := offerID(o); !after[id] {
+			c.Removed = append(c.Removed, id)
+		}
+	}
+	if offerID(prev.Cheapest) != offerID(res.Cheapest) || prev.Cheapest.Price != res.Cheapest.Price {
+		c.Cheapest = &res.Cheapest
+	}
+	if offerID(prev.Fastest) != offerID(res.Fastest) || prev.Fastest.DurationMin != res.Fastest.DurationMin {
+		c.Fastest = &res.Fastest
+	}
+	if prev.Partial != res.Partial || !sameStatuses(prev.Providers, res.Providers) {
+		c.Partial, c.Providers = &res.Partial, res.Providers
+	}
+
+	if c.Added == nil && c.Removed == nil && c.Repriced == nil && c.Cheapest == nil && c.Fastest == nil && c.Providers == nil {
+		c.Type = ChangeHeartbeat
+	}
+	return c
+}
+
+// sameStatuses compares provider outcomes, ignoring latencies.
+func sameStatuses(a, b []ProviderStatus) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Provider != b[i].Provider || a[i].Route != b[i].Route || a[i].Status != b[i].Status || a[i].Offers != b[i].Offers {
+			return false
+		}
+	}
+	return true
+}
+
+// offerID identifies an offer independently of its price: the flights it
+// is made of, or for offers without segment detail the provider, route and
+// times.
+func offerID(o providers.FlightOffer) string {
+	if o.ID != "" {
+		return o.ID
+	}
+	key := itineraryKey(o)
+	if key == "" {
+		key = fmt.Sprintf("%s|%s|%s|%s|%d|%d", o.Provider, o.Route,
+			o.DepartAt.Format(time.RFC3339), o.ArriveAt.Format(time.RFC3339), o.DurationMin, o.Stops)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
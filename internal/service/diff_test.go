@@ -0,0 +1,73 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+func diffOffer(flight string, price float64, durationMin int) providers.FlightOffer {
+	depart := time.Date(2025, 10, 1, 8, 0, 0, 0, time.UTC)
+	seg := providers.Segment{FlightNumber: flight, DepartAt: depart, ArriveAt: depart.Add(time.Duration(durationMin) * time.Minute)}
+	return providers.FlightOffer{
+		Provider: "p", Price: eur(price), DurationMin: durationMin,
+		Itineraries: []providers.Itinerary{{Segments: []providers.Segment{seg}}},
+	}
+}
+
+func diffResult(offers ...providers.FlightOffer) SearchResult {
+	res := SearchResult{All: offers, Providers: []ProviderStatus{{Provider: "p", Status: ProviderOK, Offers: len(offers)}}}
+	res.Cheapest, res.Fastest = cheapestAndFastest(offers)
+	return res
+}
+
+func TestDiffer_SnapshotThenDeltas(t *testing.T) {
+	var d Differ
+	kl, vy, ib := diffOffer("KL1", 200, 120), diffOffer("VY2", 100, 150), diffOffer("IB3", 150, 100)
+
+	c := d.Next(diffResult(kl, vy))
+	require.Equal(t, ChangeSnapshot, c.Type)
+	require.EqualValues(t, 1, c.Seq)
+	require.Len(t, c.Snapshot.All, 2)
+
+	c = d.Next(diffResult(kl, vy))
+	require.Equal(t, Change{Seq: 2, Type: ChangeHeartbeat}, c)
+
+	cheaperKL := kl
+	cheaperKL.Price = eur(90)
+	c = d.Next(diffResult(cheaperKL, ib))
+	require.Equal(t, ChangeDelta, c.Type)
+	require.EqualValues(t, 3, c.Seq)
+	require.Equal(t, []providers.FlightOffer{ib}, c.Added)
+	require.Equal(t, []string{offerID(vy)}, c.Removed)
+	require.Equal(t, []Reprice{{ID: offerID(kl), From: eur(200), To: eur(90)}}, c.Repriced)
+	require.Equal(t, "KL1", c.Cheapest.Itineraries[0].Segments[0].FlightNumber)
+	require.Equal(t, "IB3", c.Fastest.Itineraries[0].Segments[0].FlightNumber)
+	require.Nil(t, c.Providers, "the provider still returned two offers")
+}
+
+func TestDiffer_ProviderStatusChange(t *testing.T) {
+	var d Differ
+	res := diffResult(diffOffer("KL1", 200, 120))
+	d.Next(res)
+
+	res.Providers = []ProviderStatus{{Provider: "p", Status: ProviderOK, Offers: 1, LatencyMs: 999}}
+	require.Equal(t, ChangeHeartbeat, d.Next(res).Type, "latency alone is not a change")
+
+	res.Partial = true
+	res.Providers = append(res.Providers, ProviderStatus{Provider: "q", Status: ProviderTimeout})
+	c := d.Next(res)
+	require.Equal(t, ChangeDelta, c.Type)
+	require.True(t, *c.Partial)
+	require.Len(t, c.Providers, 2)
+	require.Nil(t, c.Added)
+}
+
+func TestOfferID_IgnoresPrice(t *testing.T) {
+	a, b := diffOffer("KL1", 200, 120), diffOffer("KL1", 250, 120)
+	require.Equal(t, offerID(a), offerID(b))
+	require.NotEqual(t, offerID(a), offerID(diffOffer("KL2", 200, 120)))
+	require.Len(t, offerID(providers.FlightOffer{Provider: "p"}), 16)
+}
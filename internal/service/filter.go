@@ -0,0 +1,261 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/money"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+type SortBy string
+
+const (
+	SortPrice     SortBy = "price"
+	SortDuration  SortBy = "duration"
+	SortDeparture SortBy = "departure"
+	SortArrival   SortBy = "arrival"
+	SortBest      SortBy = "best"
+	SortBestScore SortBy = "best-score" // alias of SortBest
+)
+
+// TimeWindow is a time-of-day range in minutes after midnight, in the
+// airport's local clock. From > To wraps past midnight (e.g. 22:00-02:00).
+type TimeWindow struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// ParseTimeWindow reads "HH:MM-HH:MM".
+func ParseTimeWindow(s string) (*TimeWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("bad time window %q, use HH:MM-HH:MM", s)
+	}
+	f, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("bad time window %q, use HH:MM-HH:MM", s)
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("bad time window %q, use HH:MM-HH:MM", s)
+	}
+	return &TimeWindow{From: f.Hour()*60 + f.Minute(), To: t.Hour()*60 + t.Minute()}, nil
+}
+
+func (w *TimeWindow) contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	m := t.Hour()*60 + t.Minute()
+	if w.From <= w.To {
+		return m >= w.From && m <= w.To
+	}
+	return m >= w.From || m <= w.To
+}
+
+// Filter narrows and orders a SearchResult. It is applied on top of the
+// cached provider fan-out, so the same spec serves REST, SSE and WS.
+// Zero values mean "no constraint"; MaxStops is a pointer because 0 is a
+// meaningful limit (direct flights only).
+type Filter struct {
+	MaxPrice         *money.Money `json:"max_price,omitempty"`
+	MaxStops         *int         `json:"max_stops,omitempty"`
+	MaxDurationMin   int          `json:"max_duration_min,omitempty"`
+	DepartWindow     *TimeWindow  `json:"depart_window,omitempty"` // outbound departure
+	ArriveWindow     *TimeWindow  `json:"arrive_window,omitempty"` // outbound arrival
+	Carriers         []string     `json:"carriers,omitempty"`
+	ExcludeCarriers  []string     `json:"exclude_carriers,omitempty"`
+	Providers        []string     `json:"providers,omitempty"`
+	ExcludeProviders []string     `json:"exclude_providers,omitempty"`
+	Sort             SortBy       `json:"sort,omitempty"`
+}
+
+func (f Filter) Validate() error {
+	switch f.Sort {
+	case "", SortPrice, SortDuration, SortDeparture, SortArrival, SortBest, SortBestScore:
+	default:
+		return fmt.Errorf("unknown sort %q (price, duration, departure, arrival, best-score)", f.Sort)
+	}
+	if (f.MaxPrice != nil && f.MaxPrice.Amount < 0) || f.MaxDurationMin < 0 || (f.MaxStops != nil && *f.MaxStops < 0) {
+		return fmt.Errorf("filter limits cannot be negative")
+	}
+	return nil
+}
+
+func (f Filter) match(o providers.FlightOffer) bool {
+	// a price in another currency can't be checked against the limit
+	if f.MaxPrice != nil && (o.Price.Currency != f.MaxPrice.Currency || f.MaxPrice.Less(o.Price)) {
+		return false
+	}
+	if f.MaxStops != nil && o.Stops > *f.MaxStops {
+		return false
+	}
+	if f.MaxDurationMin > 0 && o.DurationMin > f.MaxDurationMin {
+		return false
+	}
+	depart, arrive := o.DepartAt, o.ArriveAt
+	if len(o.Itineraries) > 0 {
+		depart, arrive = o.Itineraries[0].DepartAt, o.Itineraries[0].ArriveAt
+	}
+	if !f.DepartWindow.contains(depart) || !f.ArriveWindow.contains(arrive) {
+		return false
+	}
+	if len(f.Carriers) > 0 || len(f.ExcludeCarriers) > 0 {
+		carriers := o.Carriers()
+		// every carrier flown must be allowed, and none excluded
+		for _, c := range carriers {
+			if len(f.Carriers) > 0 && !containsFold(f.Carriers, c) {
+				return false
+			}
+			if containsFold(f.ExcludeCarriers, c) {
+				return false
+			}
+		}
+		if len(f.Carriers) > 0 && len(carriers) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Filter) allowsProvider(p string) bool {
+	return (len(f.Providers) == 0 || containsFold(f.Providers, p)) && !containsFold(f.ExcludeProviders, p)
+}
+
+// allowedSources rebuilds o from the providers the filter allows: a merged
+// offer loses its excluded sources and takes the provider and price of the
+// cheapest one left. It reports false when no allowed provider sells o.
+func (f Filter) allowedSources(o providers.FlightOffer) (providers.FlightOffer, bool) {
+	if len(f.Providers) == 0 && len(f.ExcludeProviders) == 0 {
+		return o, true
+	}
+	if len(o.Sources) == 0 {
+		return o, f.allowsProvider(o.Provider)
+	}
+	var kept []providers.PriceSource
+	for _, src := range o.Sources {
+		if f.allowsProvider(src.Provider) {
+			src.Cheapest = len(kept) == 0
+			kept = append(kept, src)
+		}
+	}
+	if len(kept) == 0 {
+		return o, false
+	}
+	if kept[0].Provider != o.Provider {
+		// OriginalPrice was the dropped provider's quote
+		o.Provider, o.Price, o.OriginalPrice = kept[0].Provider, kept[0].Price, nil
+	}
+	if len(kept) == 1 {
+		kept = nil
+	}
+	o.Sources = kept
+	return o, true
+}
+
+// Apply returns a copy of res holding only the matching offers, in the
+// requested order, with Cheapest and Fastest recomputed over them. Merged
+// offers are first priced by the providers the filter allows. When nothing
+// matches, All is empty and Cheapest/Fastest are zero.
+func (f Filter) Apply(res SearchResult) SearchResult {
+	out := res
+	out.All = make([]providers.FlightOffer, 0, len(res.All))
+	for _, o := range res.All {
+		o, ok := f.allowedSources(o)
+		if ok && f.match(o) {
+			out.All = append(out.All, o)
+		}
+	}
+	out.Cheapest, out.Fastest = providers.FlightOffer{}, providers.FlightOffer{}
+	if len(out.All) == 0 {
+		return out
+	}
+	out.Cheapest, out.Fastest = cheapestAndFastest(out.All)
+	sortOffers(out.All, f.Sort)
+	return out
+}
+
+func cheapestAndFastest(all []providers.FlightOffer) (cheapest, fastest providers.FlightOffer) {
+	cheapest, fastest = all[0], all[0]
+	for _, o := range all[1:] {
+		if o.Price.Less(cheapest.Price) {
+			cheapest = o
+		}
+		if o.DurationMin < fastest.DurationMin {
+			fastest = o
+		}
+	}
+	return cheapest, fastest
+}
+
+func sortOffers(all []providers.FlightOffer, by SortBy) {
+	byPrice := func(a, b providers.FlightOffer) bool {
+		if c := a.Price.Cmp(b.Price); c != 0 {
+			return c < 0
+		}
+		if a.DurationMin != b.DurationMin {
+			return a.DurationMin < b.DurationMin
+		}
+		return a.DepartAt.Before(b.DepartAt)
+	}
+	var less func(a, b providers.FlightOffer) bool
+	switch by {
+	case SortDuration:
+		less = func(a, b providers.FlightOffer) bool {
+			if a.DurationMin != b.DurationMin {
+				return a.DurationMin < b.DurationMin
+			}
+			return byPrice(a, b)
+		}
+	case SortDeparture:
+		less = func(a, b providers.FlightOffer) bool {
+			if !a.DepartAt.Equal(b.DepartAt) {
+				return a.DepartAt.Before(b.DepartAt)
+			}
+			return byPrice(a, b)
+		}
+	case SortArrival:
+		less = func(a, b providers.FlightOffer) bool {
+			if !a.ArriveAt.Equal(b.ArriveAt) {
+				return a.ArriveAt.Before(b.ArriveAt)
+			}
+			return byPrice(a, b)
+		}
+	case SortBest, SortBestScore:
+		cheapest, fastest := cheapestAndFastest(all)
+		score := func(o providers.FlightOffer) float64 {
+			return bestScore(o, cheapest.Price, fastest.DurationMin)
+		}
+		less = func(a, b providers.FlightOffer) bool {
+			sa, sb := score(a), score(b)
+			if sa != sb {
+				return sa < sb
+			}
+			return byPrice(a, b)
+		}
+	default:
+		less = byPrice
+	}
+	sort.SliceStable(all, func(i, j int) bool { return less(all[i], all[j]) })
+}
+
+// bestScore weighs price and duration relative to the best of each, plus
+// a small penalty per stop. Lower is better; the ideal offer scores 1.
+func bestScore(o providers.FlightOffer, minPrice money.Money, minDuration int) float64 {
+	score := 0.0
+	if minPrice.Amount > 0 {
+		score += 0.6 * o.Price.Float() / minPrice.Float()
+	}
+	if minDuration > 0 {
+		score += 0.4 * float64(o.DurationMin) / float64(minDuration)
+	}
+	return score + 0.1*float64(o.Stops)
+}
+
+func containsFold(list []string, s string) bool {
+	return slices.ContainsFunc(list, func(v string) bool { return strings.EqualFold(v, s) })
+}
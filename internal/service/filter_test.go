@@ -0,0 +1,110 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/money"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+func filterFixture() SearchResult {
+	day := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	offer := func(provider string, price float64, dur, stops int, depart time.Duration, carrier string) providers.FlightOffer {
+		return providers.FlightOffer{
+			Provider:    provider,
+			Price:       eur(price),
+			DurationMin: dur,
+			Stops:       stops,
+			DepartAt:    day.Add(depart),
+			ArriveAt:    day.Add(depart + time.Duration(dur)*time.Minute),
+			Itineraries: []providers.Itinerary{{
+				DepartAt: day.Add(depart),
+				ArriveAt: day.Add(depart + time.Duration(dur)*time.Minute),
+				Stops:    stops,
+				Segments: []providers.Segment{{MarketingCarrier: carrier}},
+			}},
+		}
+	}
+	all := []providers.FlightOffer{
+		offer("amadeus", 120, 150, 0, 7*time.Hour, "KL"),
+		offer("duffel", 90, 300, 1, 13*time.Hour, "VY"),
+		offer("rapid-booking", 200, 120, 0, 20*time.Hour, "KL"),
+		offer("duffel", 150, 140, 0, 9*time.Hour, "IB"),
+	}
+	return SearchResult{Cheapest: all[1], Fastest: all[2], All: all}
+}
+
+func TestFilter_Constraints(t *testing.T) {
+	res := filterFixture()
+
+	zero := 0
+	out := Filter{MaxStops: &zero}.Apply(res)
+	require.Len(t, out.All, 3)
+	require.Equal(t, eur(120), out.Cheapest.Price)
+
+	maxPrice := eur(130)
+	out = Filter{MaxPrice: &maxPrice}.Apply(res)
+	require.Len(t, out.All, 2)
+
+	out = Filter{MaxDurationMin: 145}.Apply(res)
+	require.Len(t, out.All, 2)
+	require.Equal(t, 120, out.Fastest.DurationMin)
+
+	w, err := ParseTimeWindow("06:00-10:00")
+	require.NoError(t, err)
+	out = Filter{DepartWindow: w}.Apply(res)
+	require.Len(t, out.All, 2)
+
+	night, err := ParseTimeWindow("19:00-02:00")
+	require.NoError(t, err)
+	out = Filter{DepartWindow: night}.Apply(res)
+	require.Len(t, out.All, 1)
+	require.Equal(t, "rapid-booking", out.All[0].Provider)
+
+	out = Filter{Carriers: []string{"kl"}}.Apply(res)
+	require.Len(t, out.All, 2)
+	out = Filter{ExcludeCarriers: []string{"KL"}}.Apply(res)
+	require.Len(t, out.All, 2)
+
+	out = Filter{Providers: []string{"duffel"}}.Apply(res)
+	require.Len(t, out.All, 2)
+	out = Filter{ExcludeProviders: []string{"duffel", "amadeus"}}.Apply(res)
+	require.Len(t, out.All, 1)
+
+	maxPrice = eur(10)
+	out = Filter{MaxPrice: &maxPrice}.Apply(res)
+	require.Empty(t, out.All)
+	require.True(t, out.Cheapest.Price.IsZero())
+
+	// limits in another currency can't be compared, nothing passes
+	usd := money.FromFloat(1000, "USD")
+	require.Empty(t, Filter{MaxPrice: &usd}.Apply(res).All)
+
+	// the input is left untouched
+	require.Len(t, res.All, 4)
+}
+
+func TestFilter_Sort(t *testing.T) {
+	res := filterFixture()
+	prices := func(r SearchResult) []float64 {
+		var out []float64
+		for _, o := range r.All {
+			out = append(out, o.Price.Float())
+		}
+		return out
+	}
+
+	require.Equal(t, []float64{90, 120, 150, 200}, prices(Filter{}.Apply(res)))
+	require.Equal(t, []float64{200, 150, 120, 90}, prices(Filter{Sort: SortDuration}.Apply(res)))
+	require.Equal(t, []float64{120, 150, 90, 200}, prices(Filter{Sort: SortDeparture}.Apply(res)))
+	require.Equal(t, []float64{120, 150, 90, 200}, prices(Filter{Sort: SortArrival}.Apply(res)))
+	require.Equal(t, []float64{120, 150, 90, 200}, prices(Filter{Sort: SortBest}.Apply(res)))
+	require.Equal(t, []float64{120, 150, 90, 200}, prices(Filter{Sort: SortBestScore}.Apply(res)))
+	require.NoError(t, Filter{Sort: SortBestScore}.Validate())
+
+	require.Error(t, Filter{Sort: "random"}.Validate())
+	_, err := ParseTimeWindow("6-10")
+	require.Error(t, err)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+const (
+	// hedgeSamples is how many recent successful latencies per provider
+	// the hedging delay is computed from.
+	hedgeSamples = 50
+	// hedgeMinSamples is the history needed before hedging a provider.
+	hedgeMinSamples = 10
+	// minHedgeDelay keeps a very fast provider from being hedged on noise.
+	minHedgeDelay = 50 * time.Millisecond
+)
+
+// latencies keeps a ring of recent successful call latencies per provider.
+type latencies struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+	next    map[string]int
+}
+
+func newLatencies() *latencies {
+	return &latencies{samples: map[string][]time.Duration{}, next: map[string]int{}}
+}
+
+func (l *latencies) observe(provider string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ring := l.samples[provider]
+	if len(ring) < hedgeSamples {
+		l.samples[provider] = append(ring, d)
+		return
+	}
+	ring[l.next[provider]] = d
+	l.next[provider] = (l.next[provider] + 1) % hedgeSamples
+}
+
+// percentile returns the p-quantile (0 < p < 1) of the recorded latencies,
+// false while there are too few of them.
+func (l *latencies) percentile(provider string, p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	sorted := slices.Clone(l.samples[provider])
+	l.mu.Unlock()
+	if len(sorted) < hedgeMinSamples {
+		return 0, false
+	}
+	slices.Sort(sorted)
+	idx := min(int(p*float64(len(sorted))), len(sorted)-1)
+	return sorted[idx], true
+}
+
+// providerTimeout is the configured timeout for a provider, or the search
+// budget when it has none.
+func (s *SearchService) providerTimeout(name string) time.Duration {
+	if d, ok := s.providerTimeouts[name]; ok && d > 0 {
+		return d
+	}
+	return s.searchTimeout
+}
+
+// callProvider runs one provider search within the provider's timeout.
+// With hedging on, once the call has taken longer than the provider's
+// usual latency percentile an identical second call is started and the
+// first success wins; the loser is cancelled.
+func (s *SearchService) callProvider(ctx context.Context, p providers.FlightProvider, req providers.SearchRequest) ([]providers.FlightOffer, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.providerTimeout(p.Name()))
+	defer cancel()
+
+	type result struct {
+		offers []providers.FlightOffer
+		err    error
+	}
+	results := make(chan result, 2)
+	run := func() {
+		start := time.Now()
+		offers, err := p.Search(ctx, req)
+		if err == nil {
+			s.latencies.observe(p.Name(), time.Since(start))
+		}
+		results <- result{offers, err}
+	}
+
+	var hedge <-chan time.Time
+	if s.hedgePercentile > 0 {
+		if d, ok := s.latencies.percentile(p.Name(), s.hedgePercentile); ok {
+			t := time.NewTimer(max(d, minHedgeDelay))
+			defer t.Stop()
+			hedge = t.C
+		}
+	}
+
+	go run()
+	pending, hedged := 1, false
+	for {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil || pending == 0 {
+				return r.offers, hedged, r.err
+			}
+			// one attempt failed, the other may still succeed
+		case <-hedge:
+			hedge, hedged = nil, true
+			pending++
+			go run()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+// stubbornProvider ignores cancellation and answers after delay.
+type stubbornProvider struct{ delay time.Duration }
+
+func (p stubbornProvider) Name() string { return "stubborn" }
+
+func (p stubbornProvider) Search(context.Context, providers.SearchRequest) ([]providers.FlightOffer, error) {
+	time.Sleep(p.delay)
+	return []providers.FlightOffer{{Provider: "stubborn", Price: eur(50), DurationMin: 60}}, nil
+}
+
+func fastProvider() ProviderMock {
+	return ProviderMock{name: "fast", offers: []providers.FlightOffer{{Provider: "fast", Price: eur(100), DurationMin: 60}}}
+}
+
+func TestSearch_BudgetReturnsWhatArrived(t *testing.T) {
+	svc := NewSearchService([]providers.FlightProvider{fastProvider(), stubbornProvider{delay: time.Second}},
+		100*time.Millisecond, time.Minute)
+
+	start := time.Now()
+	res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.True(t, res.Partial)
+	require.Equal(t, "fast", res.Cheapest.Provider)
+	require.Equal(t, ProviderTimeout, res.Providers[1].Status)
+	require.Equal(t, "stubborn", res.Providers[1].Provider)
+}
+
+func TestSearch_PerProviderTimeout(t *testing.T) {
+	slow := ProviderMock{name: "slow", delay: 300 * time.Millisecond,
+		offers: []providers.FlightOffer{{Provider: "slow", Price: eur(10), DurationMin: 60}}}
+	svc := NewSearchService([]providers.FlightProvider{fastProvider(), slow}, 2*time.Second, time.Minute,
+		WithProviderTimeouts(map[string]time.Duration{"slow": 50 * time.Millisecond}))
+
+	start := time.Now()
+	res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 250*time.Millisecond)
+	require.Equal(t, ProviderTimeout, res.Providers[1].Status)
+	require.Equal(t, "fast", res.Cheapest.Provider)
+}
+
+// hiccupProvider answers quickly except for one call, which hangs until
+// cancelled.
+type hiccupProvider struct {
+	calls  atomic.Int32
+	hiccup int32
+}
+
+func (p *hiccupProvider) Name() string { return "hiccup" }
+
+func (p *hiccupProvider) Search(ctx context.Context, _ providers.SearchRequest) ([]providers.FlightOffer, error) {
+	if p.calls.Add(1) == p.hiccup {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	time.Sleep(5 * time.Millisecond)
+	return []providers.FlightOffer{{Provider: "hiccup", Price: eur(100), DurationMin: 60}}, nil
+}
+
+func TestSearch_HedgesSlowCalls(t *testing.T) {
+	p := &hiccupProvider{hiccup: hedgeMinSamples + 1}
+	svc := NewSearchService([]providers.FlightProvider{p}, 2*time.Second, time.Minute, WithHedging(0.95))
+	day := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	search := func(i int) SearchResult {
+		res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", day.AddDate(0, 0, i).Format(time.DateOnly)))
+		require.NoError(t, err)
+		return res
+	}
+
+	// build up latency history, nothing to hedge yet
+	for i := range hedgeMinSamples {
+		require.False(t, search(i).Providers[0].Hedged)
+	}
+
+	start := time.Now()
+	res := search(hedgeMinSamples)
+	require.Less(t, time.Since(start), time.Second)
+	require.True(t, res.Providers[0].Hedged)
+	require.Equal(t, ProviderOK, res.Providers[0].Status)
+	require.EqualValues(t, hedgeMinSamples+2, p.calls.Load())
+}
+
+func TestLatencyPercentile(t *testing.T) {
+	l := newLatencies()
+	for i := 1; i <= hedgeSamples+10; i++ {
+		l.observe("p", time.Duration(i)*time.Millisecond)
+	}
+	// the ring holds the last hedgeSamples values: 11ms..60ms
+	p50, ok := l.percentile("p", 0.5)
+	require.True(t, ok)
+	require.Equal(t, 36*time.Millisecond, p50)
+	p99, _ := l.percentile("p", 0.99)
+	require.Equal(t, 60*time.Millisecond, p99)
+
+	_, ok = l.percentile("unknown", 0.5)
+	require.False(t, ok)
+}
@@ -1,11 +1,14 @@
 package service
 
-import "time"
+import (
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/money"
+)
 
 type MonthPoint struct {
-	Month    string  `json:"month"` // YYYY-MM
-	AvgPrice float64 `json:"avg_price"`
-	Currency string  `json:"currency"`
+	Month    string      `json:"month"` // YYYY-MM
+	AvgPrice money.Money `json:"avg_price"`
 }
 
 // HistoryService returns a synthetic, deterministic 24-month series based on route.
@@ -32,9 +35,7 @@ func (h *HistoryService) MonthlyAverages(origin, dest string, months int) []Mont
 			season = 1.25
 		}
 		price := base*season + float64((i%5)*6) + salt
-		out = append(out, MonthPoint{Month: m.Format("2006-01"), AvgPrice: round2(price), Currency: "EUR"})
+		out = append(out, MonthPoint{Month: m.Format("2006-01"), AvgPrice: money.FromFloat(price, "EUR")})
 	}
 	return out
 }
-
-func round2(v float64) float64 { return float64(int(v*100+0.5)) / 100 }
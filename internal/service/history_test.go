@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/you/go-jobsity-flights/internal/money"
 )
 
 // Helper to check monotonic month order with YYYY-MM format.
@@ -55,8 +57,8 @@ func TestMonthlyAverages_OrderFormatCurrency(t *testing.T) {
 
 	// All currencies should be EUR
 	for i, mp := range out {
-		if mp.Currency != "EUR" {
-			t.Fatalf("currency at idx %d: got %q, want %q", i, mp.Currency, "EUR")
+		if mp.AvgPrice.Currency != "EUR" {
+			t.Fatalf("currency at idx %d: got %q, want %q", i, mp.AvgPrice.Currency, "EUR")
 		}
 	}
 }
@@ -87,10 +89,10 @@ func TestMonthlyAverages_DeterministicValues(t *testing.T) {
 		}
 
 		expected := base*season + float64((i%5)*6) + salt
-		expected = round2(expected) // use the same rounding as production
+		want := money.FromFloat(expected, "EUR") // use the same rounding as production
 
-		if mp.AvgPrice != expected {
-			t.Fatalf("price at idx %d (%s): got %.2f, want %.2f", idx, mp.Month, mp.AvgPrice, expected)
+		if mp.AvgPrice != want {
+			t.Fatalf("price at idx %d (%s): got %s, want %s", idx, mp.Month, mp.AvgPrice, want)
 		}
 	}
 }
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+// DefaultStreamInterval is how often a live stream re-runs its search.
+const DefaultStreamInterval = 30 * time.Second
+
+// Update is one poll of a subscribed search.
+type Update struct {
+	Result SearchResult
+	Err    error
+	At     time.Time
+}
+
+// Hub shares live searches between SSE and WebSocket subscribers: every
+// distinct search (its cache key: route, dates, passengers, cabin,
+// currency) is polled by a single loop however many clients follow it.
+// The loop starts with the first subscriber and stops when the last one
+// leaves.
+type Hub struct {
+	svc      *SearchService
+	interval time.Duration
+
+	mu     sync.Mutex
+	topics map[string]*topic
+}
+
+type topic struct {
+	subs map[*Subscription]struct{}
+	last *Update
+	stop context.CancelFunc
+}
+
+// Subscription receives the updates of one subscribed search. A slow
+// reader only ever misses intermediate updates: C holds the latest.
+type Subscription struct {
+	C <-chan Update
+
+	ch    chan Update
+	hub   *Hub
+	key   string
+	close sync.Once
+}
+
+func NewHub(svc *SearchService, interval time.Duration) *Hub {
+	if interval <= 0 {
+		interval = DefaultStreamInterval
+	}
+	return &Hub{svc: svc, interval: interval, topics: make(map[string]*topic)}
+}
+
+// Subscribe follows req. The latest result is delivered at once when the
+// search is already being polled; otherwise the first poll starts now.
+func (h *Hub) Subscribe(req providers.SearchRequest) *Subscription {
+	req = req.WithDefaults()
+	ch := make(chan Update, 1)
+	sub := &Subscription{C: ch, ch: ch, hub: h, key: req.Key()}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[sub.key]
+	if !ok {
+		ctx, stop := context.WithCancel(context.Background())
+		t = &topic{subs: make(map[*Subscription]struct{}), stop: stop}
+		h.topics[sub.key] = t
+		go h.poll(ctx, t, req)
+	}
+	t.subs[sub] = struct{}{}
+	if t.last != nil {
+		ch <- *t.last
+	}
+	return sub
+}
+
+// Close unsubscribes; the last subscriber of a search stops its polling.
+func (s *Subscription) Close() {
+	s.close.Do(func() { s.hub.unsubscribe(s) })
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[sub.key]
+	if !ok {
+		return
+	}
+	delete(t.subs, sub)
+	if len(t.subs) == 0 {
+		t.stop()
+		delete(h.topics, sub.key)
+	}
+}
+
+func (h *Hub) poll(ctx context.Context, t *topic, req providers.SearchRequest) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		res, err := h.svc.Search(ctx, req)
+		if ctx.Err() != nil {
+			return
+		}
+		h.publish(t, Update{Result: res, Err: err, At: time.Now()})
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish hands u to every subscriber, replacing an update it has not
+// read yet.
+func (h *Hub) publish(t *topic, u Update) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t.last = &u
+	for sub := range t.subs {
+		select {
+		case <-sub.ch:
+		default:
+		}
+		sub.ch <- u
+	}
+}
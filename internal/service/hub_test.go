@@ -0,0 +1,89 @@
+package service
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+func newTestHub(interval time.Duration) (*Hub, *int32) {
+	var calls int32
+	p := ProviderMock{name: "p", callCount: &calls, offers: []providers.FlightOffer{{Provider: "p", Price: eur(100), DurationMin: 60}}}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Nanosecond, WithStaleWindow(0))
+	return NewHub(svc, interval), &calls
+}
+
+func (h *Hub) subscribers(req providers.SearchRequest) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, ok := h.topics[req.WithDefaults().Key()]
+	if !ok {
+		return 0
+	}
+	return len(t.subs)
+}
+
+func receive(t *testing.T, sub *Subscription) Update {
+	t.Helper()
+	select {
+	case u := <-sub.C:
+		return u
+	case <-time.After(time.Second):
+		t.Fatal("no update")
+		return Update{}
+	}
+}
+
+func TestHub_OnePollerPerSearch(t *testing.T) {
+	h, calls := newTestHub(time.Hour)
+	ams := providers.OneWay("AMS", "BCN", "2025-10-01")
+
+	a := h.Subscribe(ams)
+	require.NoError(t, receive(t, a).Err)
+	b := h.Subscribe(ams)
+	u := receive(t, b)
+	require.NoError(t, u.Err)
+	require.Equal(t, "p", u.Result.Cheapest.Provider)
+	require.EqualValues(t, 1, atomic.LoadInt32(calls), "the second subscriber got the latest result without a search")
+	require.Equal(t, 2, h.subscribers(ams))
+
+	other := h.Subscribe(providers.OneWay("AMS", "BCN", "2025-10-02"))
+	receive(t, other)
+	require.Len(t, h.topics, 2)
+	require.EqualValues(t, 2, atomic.LoadInt32(calls))
+
+	a.Close()
+	a.Close() // idempotent
+	require.Equal(t, 1, h.subscribers(ams))
+	b.Close()
+	require.Zero(t, h.subscribers(ams))
+	other.Close()
+	require.Empty(t, h.topics)
+}
+
+func TestHub_StopsPollingWithLastSubscriber(t *testing.T) {
+	h, calls := newTestHub(10 * time.Millisecond)
+	sub := h.Subscribe(providers.OneWay("AMS", "BCN", "2025-10-01"))
+	receive(t, sub)
+	receive(t, sub)
+	sub.Close()
+
+	time.Sleep(20 * time.Millisecond) // let an in-flight poll settle
+	n := atomic.LoadInt32(calls)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, n, atomic.LoadInt32(calls))
+}
+
+func TestHub_SlowSubscriberGetsLatest(t *testing.T) {
+	h, _ := newTestHub(10 * time.Millisecond)
+	sub := h.Subscribe(providers.OneWay("AMS", "BCN", "2025-10-01"))
+	defer sub.Close()
+	first := receive(t, sub)
+
+	time.Sleep(50 * time.Millisecond) // several polls go by unread
+	u := receive(t, sub)
+	require.True(t, u.At.After(first.At.Add(20*time.Millisecond)), "older updates were replaced")
+}
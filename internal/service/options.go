@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/airports"
+	"github.com/you/go-jobsity-flights/internal/cache"
+	"github.com/you/go-jobsity-flights/internal/money"
+)
+
+// Option customises a SearchService beyond the required settings.
+type Option func(*SearchService)
+
+// CurrencyConverter turns an amount into another currency.
+type CurrencyConverter interface {
+	Convert(ctx context.Context, m money.Money, to string) (money.Money, error)
+}
+
+// WithConverter normalises every offer to the requested currency before
+// ranking. Without one, offers keep the currency their provider quoted.
+func WithConverter(c CurrencyConverter) Option {
+	return func(s *SearchService) { s.converter = c }
+}
+
+// WithAirports replaces the embedded airport database used to expand city
+// codes and nearby airports; nil disables expansion.
+func WithAirports(db *airports.DB) Option {
+	return func(s *SearchService) { s.airports = db }
+}
+
+// WithCache replaces the default in-memory result cache.
+func WithCache(c cache.Cache[CacheEntry]) Option {
+	return func(s *SearchService) { s.cache = c }
+}
+
+// WithSnapshotStore replaces the default in-memory store of pagination
+// snapshots, e.g. with one shared by every replica.
+func WithSnapshotStore(c cache.Cache[Snapshot]) Option {
+	return func(s *SearchService) { s.snapshots = c }
+}
+
+// WithProviderTimeouts gives individual providers, by name, a shorter
+// timeout than the overall search budget.
+func WithProviderTimeouts(timeouts map[string]time.Duration) Option {
+	return func(s *SearchService) { s.providerTimeouts = timeouts }
+}
+
+// WithHedging fires a second, identical call to a provider when the first
+// takes longer than the given percentile (e.g. 0.95) of its recent
+// latencies. 0 disables hedging.
+func WithHedging(percentile float64) Option {
+	return func(s *SearchService) { s.hedgePercentile = percentile }
+}
+
+// WithStaleWindow keeps results for d after the cache TTL, serving them
+// stale while a background search refreshes them.
+func WithStaleWindow(d time.Duration) Option {
+	return func(s *SearchService) { s.staleWindow = d }
+}
+
+// WithNegativeTTL caches failed searches for d so a broken route does not
+// reach the providers on every request.
+func WithNegativeTTL(d time.Duration) Option {
+	return func(s *SearchService) { s.negativeTTL = d }
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/cache"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+const (
+	DefaultSnapshotTTL = 10 * time.Minute
+	// DefaultSnapshotEntries bounds the in-memory snapshot store.
+	DefaultSnapshotEntries = 1_000
+	MaxPageSize            = 200
+)
+
+var (
+	ErrBadCursor       = errors.New("invalid cursor")
+	ErrSnapshotExpired = errors.New("result snapshot expired, search again")
+)
+
+// Snapshot freezes a (filtered, sorted) search result so that every page
+// of a paginated listing comes from the same provider fan-out.
+type Snapshot struct {
+	ID      string                  `json:"id"`
+	Request providers.SearchRequest `json:"request"`
+	Result  SearchResult            `json:"result"`
+}
+
+// Page is one window over a snapshot.
+type Page struct {
+	SnapshotID string                  `json:"snapshot_id"`
+	Offers     []providers.FlightOffer `json:"offers"`
+	Total      int                     `json:"total"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// SaveSnapshot stores res under a fresh id for the snapshot TTL. When the
+// store is full the least recently read snapshots go first.
+func (s *SearchService) SaveSnapshot(ctx context.Context, req providers.SearchRequest, res SearchResult) Snapshot {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	snap := Snapshot{ID: hex.EncodeToString(b), Request: req, Result: res}
+	s.snapshots.Set(ctx, snap.ID, snap, s.snapshotTTL)
+	return snap
+}
+
+func (s *SearchService) Snapshot(ctx context.Context, id string) (Snapshot, error) {
+	snap, ok := s.snapshots.Get(ctx, id)
+	if !ok {
+		return Snapshot{}, ErrSnapshotExpired
+	}
+	return snap, nil
+}
+
+// Page returns up to limit offers starting at offset.
+func (snap Snapshot) Page(offset, limit int) Page {
+	all := snap.Result.All
+	offset = min(max(offset, 0), len(all))
+	end := offset + min(max(limit, 0), len(all)-offset)
+	p := Page{SnapshotID: snap.ID, Offers: all[offset:end], Total: len(all)}
+	if end < len(all) {
+		p.NextCursor = EncodeCursor(snap.ID, end, limit)
+	}
+	return p
+}
+
+// EncodeCursor makes an opaque cursor pointing at offset within a snapshot.
+func EncodeCursor(snapshotID string, offset, limit int) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%s:%d:%d", snapshotID, offset, limit))
+}
+
+// DecodeCursor reads a cursor made by EncodeCursor. Cursors come from
+// clients, so the page size is checked like the limit parameter.
+func DecodeCursor(c string) (snapshotID string, offset, limit int, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return "", 0, 0, ErrBadCursor
+	}
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", 0, 0, ErrBadCursor
+	}
+	if offset, err = strconv.Atoi(parts[1]); err != nil || offset < 0 {
+		return "", 0, 0, ErrBadCursor
+	}
+	if limit, err = strconv.Atoi(parts[2]); err != nil || limit <= 0 || limit > MaxPageSize {
+		return "", 0, 0, ErrBadCursor
+	}
+	return parts[0], offset, limit, nil
+}
+
+// NewSnapshotStore returns an LRU for snapshots holding at most maxEntries.
+func NewSnapshotStore(maxEntries int) *cache.LRU[Snapshot] {
+	return cache.NewLRU[Snapshot](maxEntries, 0, nil)
+}
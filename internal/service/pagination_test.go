@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+func TestSnapshotPagination(t *testing.T) {
+	cfg := &config.Config{
+		SearchTimeout: 5 * time.Second,
+		CacheTTL:      time.Millisecond,
+	}
+
+	var calls int32
+	offers := make([]providers.FlightOffer, 0, 5)
+	for i := range 5 {
+		offers = append(offers, providers.FlightOffer{Provider: "p1", Price: eur(float64(100 + i)), DurationMin: 90})
+	}
+	prov := &ProviderMock{name: "p1", cfg: cfg, callCount: &calls, offers: offers}
+	s := NewSearchService([]providers.FlightProvider{prov}, cfg.SearchTimeout, cfg.CacheTTL)
+
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+	res, err := s.Search(context.Background(), req)
+	require.NoError(t, err)
+
+	snap := s.SaveSnapshot(context.Background(), req, res)
+	page := snap.Page(0, 2)
+	require.Len(t, page.Offers, 2)
+	require.Equal(t, 5, page.Total)
+	require.NotEmpty(t, page.NextCursor)
+
+	// walk the remaining pages through the cursor alone
+	var prices []float64
+	for _, o := range page.Offers {
+		prices = append(prices, o.Price.Float())
+	}
+	cursor := page.NextCursor
+	for cursor != "" {
+		id, offset, limit, err := DecodeCursor(cursor)
+		require.NoError(t, err)
+		require.Equal(t, 2, limit)
+		got, err := s.Snapshot(context.Background(), id)
+		require.NoError(t, err)
+		p := got.Page(offset, limit)
+		for _, o := range p.Offers {
+			prices = append(prices, o.Price.Float())
+		}
+		cursor = p.NextCursor
+	}
+	require.Equal(t, []float64{100, 101, 102, 103, 104}, prices)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	_, _, _, err = DecodeCursor("not a cursor")
+	require.ErrorIs(t, err, ErrBadCursor)
+	_, _, _, err = DecodeCursor(EncodeCursor(snap.ID, 1, MaxPageSize+1))
+	require.ErrorIs(t, err, ErrBadCursor)
+
+	// out of range windows are clamped, never sliced past the offers
+	require.Len(t, snap.Page(1, math.MaxInt).Offers, 4)
+	require.Empty(t, snap.Page(math.MaxInt, math.MaxInt).Offers)
+
+	s.snapshotTTL = 0
+	expired := s.SaveSnapshot(context.Background(), req, res)
+	time.Sleep(time.Millisecond)
+	_, err = s.Snapshot(context.Background(), expired.ID)
+	require.ErrorIs(t, err, ErrSnapshotExpired)
+}
+
+func TestSnapshotStoreIsBounded(t *testing.T) {
+	s := NewSearchService(nil, time.Second, time.Second, WithSnapshotStore(NewSnapshotStore(2)))
+	ctx := context.Background()
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+
+	first := s.SaveSnapshot(ctx, req, SearchResult{})
+	for range 2 {
+		s.SaveSnapshot(ctx, req, SearchResult{})
+	}
+	_, err := s.Snapshot(ctx, first.ID)
+	require.ErrorIs(t, err, ErrSnapshotExpired, "the oldest snapshot makes room")
+}
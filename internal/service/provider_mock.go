@@ -23,7 +23,7 @@ func (p ProviderMock) Name() string {
 	return p.name
 }
 
-func (p ProviderMock) Search(ctx context.Context, o, d, dt string) ([]providers.FlightOffer, error) {
+func (p ProviderMock) Search(ctx context.Context, req providers.SearchRequest) ([]providers.FlightOffer, error) {
 	if p.callCount != nil {
 		atomic.AddInt32(p.callCount, 1)
 	}
@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/you/go-jobsity-flights/internal/cache"
+)
+
+const (
+	// DefaultReplaySize is how many recent messages a stream keeps for
+	// clients that reconnect.
+	DefaultReplaySize = 64
+	// DefaultResumeWindow is how long a disconnected stream can be resumed.
+	DefaultResumeWindow = 5 * time.Minute
+	// DefaultIdleStreams bounds the disconnected streams kept for resuming.
+	DefaultIdleStreams = 10_000
+)
+
+// StreamSessions keeps live streams resumable: each stream owns the
+// Differ of one client and a ring buffer of the messages it was sent. A
+// client that reconnects within the resume window with the id of the last
+// message it saw gets the newer messages replayed and then carries on with
+// the same sequence. A stream has one connection at a time.
+//
+// Streams nobody is connected to wait in an LRU until the resume window
+// runs out, so their expiry is the cache's, like pagination snapshots.
+type StreamSessions struct {
+	size   int
+	window time.Duration
+
+	mu   sync.Mutex
+	live map[string]*stream // streams with a connection
+	idle *cache.LRU[*stream]
+}
+
+// stream is the resumable state behind a StreamSession.
+type stream struct {
+	id  string
+	key string // the search followed, a stream never switches searches
+
+	mu    sync.Mutex
+	diff  Differ
+	ring  []Change // the last len(ring) messages, oldest first once full
+	next  int
+	full  bool
+	owner *StreamSession // the connection sending, nil once it left
+}
+
+// StreamSession is one connection's hold on a resumable stream.
+type StreamSession struct {
+	ID string
+
+	stream *stream
+	taken  chan struct{}
+}
+
+func NewStreamSessions(size int, window time.Duration) *StreamSessions {
+	if size <= 0 {
+		size = DefaultReplaySize
+	}
+	return &StreamSessions{
+		size:   size,
+		window: window,
+		live:   make(map[string]*stream),
+		idle:   cache.NewLRU[*stream](DefaultIdleStreams, 0, nil),
+	}
+}
+
+// Run sweeps streams whose resume window ran out every interval until ctx
+// is done.
+func (ss *StreamSessions) Run(ctx context.Context, interval time.Duration) {
+	ss.idle.Run(ctx, interval)
+}
+
+// EventID renders the SSE id of a message: session and sequence number.
+func (s *StreamSession) EventID(c Change) string {
+	return s.ID + ":" + strconv.FormatInt(c.Seq, 10)
+}
+
+// ParseEventID splits an id made by EventID.
+func ParseEventID(id string) (session string, seq int64, err error) {
+	session, n, ok := strings.Cut(id, ":")
+	if ok {
+		seq, err = strconv.ParseInt(n, 10, 64)
+	}
+	if !ok || err != nil || session == "" {
+		return "", 0, fmt.Errorf("bad event id %q", id)
+	}
+	return session, seq, nil
+}
+
+// Open resumes the stream of lastEventID when it follows the same search
+// (key) and has not expired, returning the messages the client missed.
+// Otherwise, and when the missed messages are no longer buffered, the
+// client starts over: a new stream, or the old one re-sending a snapshot
+// with its sequence carrying on. A connection still holding a resumed
+// stream, typically one whose client is gone unnoticed, loses it: its
+// Taken channel is closed and its Next calls fail. Release the session
+// when the client disconnects.
+func (ss *StreamSessions) Open(key, lastEventID string) (sess *StreamSession, replay []Change) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if id, seq, err := ParseEventID(lastEventID); err == nil {
+		st, ok := ss.live[id]
+		if !ok {
+			st, ok = ss.idle.Get(context.Background(), id)
+		}
+		if ok && st.key == key {
+			ss.idle.Delete(context.Background(), id)
+			ss.live[id] = st
+			sess = st.attach()
+			if replay, ok := st.since(seq); ok {
+				return sess, replay
+			}
+			st.restart()
+			return sess, nil
+		}
+	}
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	st := &stream{id: hex.EncodeToString(b), key: key, ring: make([]Change, ss.size)}
+	ss.live[st.id] = st
+	return st.attach(), nil
+}
+
+// Release ends sess; its stream stays resumable for the resume window
+// unless another connection already took it over.
+func (ss *StreamSessions) Release(sess *StreamSession) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	st := sess.stream
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.owner != sess {
+		return
+	}
+	st.owner = nil
+	delete(ss.live, st.id)
+	ss.idle.Set(context.Background(), st.id, st, ss.window)
+}
+
+// Taken is closed when a reconnecting client took the stream over; the
+// connection should stop then.
+func (s *StreamSession) Taken() <-chan struct{} {
+	return s.taken
+}
+
+// Next diffs res against what this stream last sent and buffers the
+// message for replay. It fails once the stream was taken over.
+func (s *StreamSession) Next(res SearchResult) (Change, bool) {
+	st := s.stream
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.owner != s {
+		return Change{}, false
+	}
+	c := st.diff.Next(res)
+	st.ring[st.next] = c
+	st.next = (st.next + 1) % len(st.ring)
+	if st.next == 0 {
+		st.full = true
+	}
+	return c, true
+}
+
+// attach makes a new connection the only one sending on st.
+func (st *stream) attach() *StreamSession {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.owner != nil {
+		close(st.owner.taken)
+	}
+	st.owner = &StreamSession{ID: st.id, stream: st, taken: make(chan struct{})}
+	return st.owner
+}
+
+// since returns the buffered messages after seq, oldest first. It fails
+// when some of them were already overwritten or seq was never sent.
+func (st *stream) since(seq int64) ([]Change, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	buffered := st.buffered()
+	if seq > st.diff.seq || (len(buffered) > 0 && seq < buffered[0].Seq-1) {
+		return nil, false
+	}
+	var out []Change
+	for _, c := range buffered {
+		if c.Seq > seq {
+			out = append(out, c)
+		}
+	}
+	return out, true
+}
+
+func (st *stream) buffered() []Change {
+	if !st.full {
+		return st.ring[:st.next]
+	}
+	return append(append([]Change(nil), st.ring[st.next:]...), st.ring[:st.next]...)
+}
+
+// restart makes the next message a snapshot again, keeping the sequence.
+func (st *stream) restart() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.diff.prev = nil
+	st.next, st.full = 0, false
+}
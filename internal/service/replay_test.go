@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mustNext is StreamSession.Next for sessions that must still own their stream.
+func mustNext(t *testing.T, sess *StreamSession, res SearchResult) Change {
+	t.Helper()
+	c, ok := sess.Next(res)
+	require.True(t, ok, "the stream was taken over")
+	return c
+}
+
+func TestStreamSessions_ReplayAndResume(t *testing.T) {
+	ss := NewStreamSessions(3, time.Minute)
+	res := diffResult(diffOffer("KL1", 200, 120))
+
+	sess, replay := ss.Open("k", "")
+	require.Empty(t, replay)
+	var sent []Change
+	for range 4 {
+		sent = append(sent, mustNext(t, sess, res))
+	}
+	ss.Release(sess)
+
+	again, replay := ss.Open("k", sess.EventID(sent[1]))
+	require.Equal(t, sess.ID, again.ID)
+	require.Equal(t, sent[2:], replay)
+
+	_, replay = ss.Open("k", sess.EventID(sent[3]))
+	require.Empty(t, replay, "up to date")
+}
+
+func TestStreamSessions_EvictedMessagesRestartWithSnapshot(t *testing.T) {
+	ss := NewStreamSessions(2, time.Minute)
+	res := diffResult(diffOffer("KL1", 200, 120))
+	sess, _ := ss.Open("k", "")
+	first := mustNext(t, sess, res)
+	for range 3 {
+		mustNext(t, sess, res)
+	}
+	ss.Release(sess)
+
+	again, replay := ss.Open("k", sess.EventID(first))
+	require.Equal(t, sess.ID, again.ID)
+	require.Empty(t, replay)
+	c := mustNext(t, again, res)
+	require.Equal(t, ChangeSnapshot, c.Type)
+	require.EqualValues(t, 5, c.Seq, "the sequence keeps growing")
+}
+
+func TestStreamSessions_ResumeTakesOver(t *testing.T) {
+	ss := NewStreamSessions(4, time.Minute)
+	res := diffResult(diffOffer("KL1", 200, 120))
+
+	// the first connection is still attached when its client comes back
+	old, _ := ss.Open("k", "")
+	c := mustNext(t, old, res)
+	resumed, _ := ss.Open("k", old.EventID(c))
+
+	select {
+	case <-old.Taken():
+	default:
+		t.Fatal("the old connection should be told to stop")
+	}
+	_, ok := old.Next(res)
+	require.False(t, ok, "only the new connection sends")
+	require.EqualValues(t, 2, mustNext(t, resumed, res).Seq, "no message was spent on the old connection")
+
+	// the old connection leaving does not end the resumed one
+	ss.Release(old)
+	require.Contains(t, ss.live, resumed.ID)
+	ss.Release(resumed)
+	require.NotContains(t, ss.live, resumed.ID)
+}
+
+func TestStreamSessions_ExpiryAndKeyMismatch(t *testing.T) {
+	ss := NewStreamSessions(4, 20*time.Millisecond)
+	sess, _ := ss.Open("k", "")
+	c := mustNext(t, sess, SearchResult{})
+	ss.Release(sess)
+
+	other, _ := ss.Open("other", sess.EventID(c))
+	require.NotEqual(t, sess.ID, other.ID, "an id from another search is not resumed")
+
+	time.Sleep(30 * time.Millisecond)
+	fresh, _ := ss.Open("k", sess.EventID(c))
+	require.NotEqual(t, sess.ID, fresh.ID, "expired")
+	require.Contains(t, ss.live, other.ID, "still connected")
+}
+
+func TestParseEventID(t *testing.T) {
+	id, seq, err := ParseEventID("ab12:7")
+	require.NoError(t, err)
+	require.Equal(t, "ab12", id)
+	require.EqualValues(t, 7, seq)
+	for _, bad := range []string{"", "ab12", ":7", "ab12:x"} {
+		_, _, err := ParseEventID(bad)
+		require.Error(t, err, bad)
+	}
+}
@@ -3,118 +3,533 @@ package service
 import (
 	"context"
 	"errors"
-	"sort"
-	"sync"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/you/go-jobsity-flights/internal/airports"
+	"github.com/you/go-jobsity-flights/internal/cache"
 	"github.com/you/go-jobsity-flights/internal/providers"
-	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
-type SearchResult struct {
-	Cheapest providers.FlightOffer   `json:"cheapest"`
-	Fastest  providers.FlightOffer   `json:"fastest"`
-	All      []providers.FlightOffer `json:"all"`
+const (
+	ProviderOK             = "ok"
+	ProviderError          = "error"
+	ProviderTimeout        = "timeout"
+	ProviderCircuitOpen    = "circuit_open"    // skipped, its breaker is open
+	ProviderQuotaExhausted = "quota_exhausted" // not called, its quota is used up
+	ProviderRateLimited    = "rate_limited"    // not called, waiting for its rate limit would outlast the budget
+)
+
+// ProviderStatus reports how a single provider behaved during a search fan-out.
+type ProviderStatus struct {
+	Provider  string `json:"provider"`
+	Status    string `json:"status"` // ok | error | timeout | circuit_open | quota_exhausted | rate_limited
+	LatencyMs int64  `json:"latency_ms"`
+	Offers    int    `json:"offers"`
+	Hedged    bool   `json:"hedged,omitempty"` // a second, hedged call was made
+	Route     string `json:"route,omitempty"`  // concrete airports queried, when the search was expanded
+	Error     string `json:"error,omitempty"`
 }
 
-type cacheEntry struct {
-	value     SearchResult
-	expiresAt time.Time
+// ProviderResult is one provider's answer during a streamed search: its
+// status and, under results, its offers converted to the requested currency but not yet
+// merged with other providers' offers.
+type ProviderResult struct {
+	ProviderStatus
+	Results []providers.FlightOffer `json:"results"`
+}
+
+type SearchResult struct {
+	Cheapest  providers.FlightOffer   `json:"cheapest"`
+	Fastest   providers.FlightOffer   `json:"fastest"`
+	All       []providers.FlightOffer `json:"all"`
+	Partial   bool                    `json:"partial"`
+	Providers []ProviderStatus        `json:"providers"`
+	// SkippedRoutes are the airport pairs left out by the route cap; they
+	// make the result partial.
+	SkippedRoutes []string `json:"skipped_routes,omitempty"`
 }
 
 type SearchService struct {
 	providers     []providers.FlightProvider
-	cache         map[string]cacheEntry
-	mu            sync.RWMutex
+	cache         cache.Cache[CacheEntry]
 	searchTimeout time.Duration
 	cacheTTL      time.Duration
+	staleWindow   time.Duration
+	negativeTTL   time.Duration
+
+	snapshots   cache.Cache[Snapshot]
+	snapshotTTL time.Duration
+
+	inflight singleflight.Group
+
+	providerTimeouts map[string]time.Duration
+	hedgePercentile  float64
+	latencies        *latencies
+
+	converter CurrencyConverter
+	airports  *airports.DB
 }
 
-func NewSearchService(prov []providers.FlightProvider, timeout, ttl time.Duration) *SearchService {
-	return &SearchService{
+func NewSearchService(prov []providers.FlightProvider, timeout, ttl time.Duration, opts ...Option) *SearchService {
+	s := &SearchService{
 		providers:     prov,
-		cache:         make(map[string]cacheEntry),
+		cache:         NewResultCache(DefaultCacheEntries, 0),
 		searchTimeout: timeout,
 		cacheTTL:      ttl,
+		snapshots:     NewSnapshotStore(DefaultSnapshotEntries),
+		snapshotTTL:   DefaultSnapshotTTL,
+		airports:      airports.Default(),
+		latencies:     newLatencies(),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Airports returns the airport database used for expansion, or nil.
+func (s *SearchService) Airports() *airports.DB {
+	return s.airports
+}
+
+// cacheKey identifies the result of req. A route cap the expansion never
+// reaches changes nothing, so it is left out of the key: a calendar cell
+// then shares its entry with the plain search for the same date.
+func (s *SearchService) cacheKey(req providers.SearchRequest) string {
+	if req.MaxRoutes > 0 && req.MaxRoutes >= s.routeCount(req) {
+		req.MaxRoutes = 0
 	}
+	return req.Key()
+}
+
+// Search fans out to every provider and returns whatever offers came back.
+// A failing or slow provider does not abort the others: its outcome is
+// recorded in SearchResult.Providers and the result is flagged as Partial.
+// An error is only returned when no provider produced offers.
+//
+// Concurrent searches for the same cache key share one fan-out. It runs
+// detached from any single caller, so a caller that goes away only stops
+// waiting: the others still get the result and it is cached.
+func (s *SearchService) Search(ctx context.Context, req providers.SearchRequest) (SearchResult, error) {
+	res, _, err := s.SearchWithFreshness(ctx, req)
+	return res, err
 }
 
-func (s *SearchService) cacheKey(origin, dest, date string) string {
-	return origin + "|" + dest + "|" + date
+// SearchWithFreshness is Search, also reporting where the result came from.
+// Within the stale window after cacheTTL an expired result is returned at
+// once, flagged stale, while a background refresh replaces it. Failed
+// searches are remembered for the negative TTL and returned as errors
+// without calling providers again.
+func (s *SearchService) SearchWithFreshness(ctx context.Context, req providers.SearchRequest) (SearchResult, Freshness, error) {
+	req = req.WithDefaults()
+	if err := req.Validate(); err != nil {
+		return SearchResult{}, Freshness{}, err
+	}
+	key := s.cacheKey(req)
+	if e, fr, ok := s.lookup(ctx, key, req); ok {
+		return e.Result, fr, e.err()
+	}
+
+	ch := s.inflight.DoChan(key, func() (any, error) {
+		res, err := s.fanOut(context.WithoutCancel(ctx), req, nil)
+		s.store(key, res, err)
+		return res, err
+	})
+	select {
+	case r := <-ch:
+		return r.Val.(SearchResult), Freshness{Source: SourceProviders}, r.Err
+	case <-ctx.Done():
+		return SearchResult{}, Freshness{}, ctx.Err()
+	}
 }
 
-func (s *SearchService) Search(ctx context.Context, origin, dest, date string) (SearchResult, error) {
-	key := s.cacheKey(origin, dest, date)
-	// fast cache path
-	s.mu.RLock()
-	if ce, ok := s.cache[key]; ok && time.Now().Before(ce.expiresAt) {
-		s.mu.RUnlock()
-		return ce.value, nil
+// lookup reads key from the cache. An entry past its fresh period is
+// returned flagged stale and refreshed in the background.
+func (s *SearchService) lookup(ctx context.Context, key string, req providers.SearchRequest) (CacheEntry, Freshness, bool) {
+	e, ok := s.cache.Get(ctx, key)
+	if !ok {
+		return CacheEntry{}, Freshness{}, false
 	}
-	s.mu.RUnlock()
+	now := time.Now()
+	fr := Freshness{Source: SourceCache, Age: now.Sub(e.FetchedAt)}
+	if !now.Before(e.FreshUntil) {
+		fr.Stale = true
+		s.refresh(key, req)
+	}
+	return e, fr, true
+}
 
+// refresh re-runs a stale search in the background. A failed refresh keeps
+// the stale result rather than replacing it with the error.
+func (s *SearchService) refresh(key string, req providers.SearchRequest) {
+	s.inflight.DoChan(key, func() (any, error) {
+		res, err := s.fanOut(context.Background(), req, nil)
+		if err == nil {
+			s.store(key, res, nil)
+		}
+		return res, err
+	})
+}
+
+// store caches a result for cacheTTL plus the stale window, or an error
+// for the negative TTL.
+func (s *SearchService) store(key string, res SearchResult, err error) {
+	now := time.Now()
+	e := CacheEntry{Result: res, FetchedAt: now}
+	ttl := s.cacheTTL
+	if err != nil {
+		if s.negativeTTL <= 0 {
+			return
+		}
+		e.Error, ttl = err.Error(), s.negativeTTL
+	}
+	e.FreshUntil = now.Add(ttl)
+	if err == nil {
+		ttl += s.staleWindow
+	}
+	s.cache.Set(context.Background(), key, e, ttl)
+}
+
+// fanOut queries every provider for every expanded route and merges what
+// came back. A non-nil onResult sees each call's outcome, timeouts
+// included, as soon as it is known; it runs on the calling goroutine.
+func (s *SearchService) fanOut(ctx context.Context, req providers.SearchRequest, onResult func(ProviderResult)) (SearchResult, error) {
 	ctx, cancel := context.WithTimeout(ctx, s.searchTimeout)
 	defer cancel()
 
-	var mu sync.Mutex
-	var all []providers.FlightOffer
-	g, ctx := errgroup.WithContext(ctx)
+	routes, skipped := s.expandRoutes(req)
+	type task struct {
+		provider providers.FlightProvider
+		route    providers.SearchRequest
+	}
+	var tasks []task
+	for _, route := range routes {
+		for _, p := range s.providers {
+			tasks = append(tasks, task{provider: p, route: route})
+		}
+	}
 
-	for _, p := range s.providers {
-		p := p
-		g.Go(func() error {
-			offers, err := p.Search(ctx, origin, dest, date)
+	type outcome struct {
+		i      int
+		status ProviderStatus
+		offers []providers.FlightOffer
+		err    error
+	}
+	done := make(chan outcome, len(tasks))
+	start := time.Now()
+	for i, t := range tasks {
+		p := t.provider
+		label := routeLabel(t.route)
+		go func() {
+			offers, hedged, err := s.callProvider(ctx, p, t.route)
+			st := ProviderStatus{
+				Provider:  p.Name(),
+				Status:    ProviderOK,
+				LatencyMs: time.Since(start).Milliseconds(),
+				Hedged:    hedged,
+			}
+			if len(routes) > 1 {
+				st.Route = label
+			}
 			if err != nil {
-				return err
+				st.Status = providerErrorStatus(err)
+				st.Error = err.Error()
+				done <- outcome{i: i, status: st, err: err}
+				return
 			}
+
+			// copy so later sorting never touches the provider's slice
 			fos := make([]providers.FlightOffer, 0, len(offers))
+			var dropErr error
 			for _, o := range offers {
-				fos = append(fos, providers.FlightOffer{
-					Provider:    o.Provider,
-					Price:       o.Price,
-					Currency:    o.Currency,
-					DurationMin: o.DurationMin,
-					DepartAt:    o.DepartAt,
-					ArriveAt:    o.ArriveAt,
-				})
+				o, err := s.normalizeCurrency(ctx, o, req.Currency)
+				if err != nil {
+					log.Printf("%s: dropping offer: %v", p.Name(), err)
+					if dropErr == nil {
+						dropErr = err
+					}
+					continue
+				}
+				if len(routes) > 1 {
+					o.Route = label
+				}
+				fos = append(fos, o)
 			}
-			mu.Lock()
-			all = append(all, fos...)
-			mu.Unlock()
-			return nil
-		})
+			// the status counts what is served, and says why the rest is not
+			st.Offers = len(fos)
+			if dropped := len(offers) - len(fos); dropped > 0 {
+				st.Error = fmt.Sprintf("%d offers dropped: %v", dropped, dropErr)
+			}
+			done <- outcome{i: i, status: st, offers: fos}
+		}()
 	}
 
-	if err := g.Wait(); err != nil {
-		return SearchResult{}, err
+	// Collect until every call reported or the search budget is spent.
+	// Calls still running then count as timed out; a provider that ignores
+	// cancellation cannot hold the search up, its late answer is dropped.
+	var (
+		all      []providers.FlightOffer
+		errs     = make([]error, len(tasks))
+		failed   bool
+		statuses = make([]ProviderStatus, len(tasks))
+		reported = make([]bool, len(tasks))
+	)
+	collect := func(o outcome) {
+		reported[o.i], statuses[o.i] = true, o.status
+		if onResult != nil {
+			onResult(ProviderResult{ProviderStatus: o.status, Results: o.offers})
+		}
+		if o.err != nil {
+			errs[o.i], failed = o.err, true
+			return
+		}
+		all = append(all, o.offers...)
+	}
+wait:
+	for range tasks {
+		select {
+		case o := <-done:
+			collect(o)
+		case <-ctx.Done():
+			break wait
+		}
+	}
+drain: // answers that arrived together with the deadline still count
+	for {
+		select {
+		case o := <-done:
+			collect(o)
+		default:
+			break drain
+		}
+	}
+	for i, t := range tasks {
+		if reported[i] {
+			continue
+		}
+		st := ProviderStatus{
+			Provider:  t.provider.Name(),
+			Status:    ProviderTimeout,
+			LatencyMs: time.Since(start).Milliseconds(),
+			Error:     "no answer within the search budget",
+		}
+		if len(routes) > 1 {
+			st.Route = routeLabel(t.route)
+		}
+		statuses[i] = st
+		errs[i] = fmt.Errorf("%s: %w", st.Provider, context.DeadlineExceeded)
+		failed = true
+		if onResult != nil {
+			onResult(ProviderResult{ProviderStatus: st})
+		}
 	}
+
 	if len(all) == 0 {
-		return SearchResult{}, errors.New("no offers found")
+		if failed {
+			return SearchResult{Partial: true, Providers: statuses, SkippedRoutes: skipped}, errors.Join(errs...)
+		}
+		return SearchResult{Partial: len(skipped) > 0, Providers: statuses, SkippedRoutes: skipped}, errors.New("no offers found")
+	}
+
+	all = mergeOffers(all)
+	for i := range all {
+		all[i].ID = offerID(all[i])
 	}
+	cheapest, fastest := cheapestAndFastest(all)
+	sortOffers(all, SortPrice)
 
-	sortedByPrice := append([]providers.FlightOffer(nil), all...)
-	sort.Slice(sortedByPrice, func(i, j int) bool { return sortedByPrice[i].Price < sortedByPrice[j].Price })
-	cheapest := sortedByPrice[0]
+	res := SearchResult{
+		Cheapest:      cheapest,
+		Fastest:       fastest,
+		All:           all,
+		Partial:       failed || len(skipped) > 0,
+		Providers:     statuses,
+		SkippedRoutes: skipped,
+	}
+	return res, nil
+}
 
-	sortedByDuration := append([]providers.FlightOffer(nil), all...)
-	sort.Slice(sortedByDuration, func(i, j int) bool { return sortedByDuration[i].DurationMin < sortedByDuration[j].DurationMin })
-	fastest := sortedByDuration[0]
+// MaxRoutes caps how many concrete airport combinations one search may fan
+// out to after city and nearby-airport expansion. A request can lower it
+// with SearchRequest.MaxRoutes.
+const MaxRoutes = 12
 
-	sort.Slice(all, func(i, j int) bool {
-		if all[i].Price != all[j].Price {
-			return all[i].Price < all[j].Price
+// expandRoutes turns city codes (and, with NearbyKm, nearby airports) into
+// the concrete airport combinations to query, up to the route cap. They are
+// taken in an order that reaches every airport before pairing any of them
+// twice, so the cap cuts evenly across origins and destinations. skipped
+// lists the airport pairs no queried route covers.
+func (s *SearchService) expandRoutes(req providers.SearchRequest) (routes []providers.SearchRequest, skipped []string) {
+	if s.airports == nil {
+		return []providers.SearchRequest{req}, nil
+	}
+	limit := MaxRoutes
+	if req.MaxRoutes > 0 {
+		limit = min(limit, req.MaxRoutes)
+	}
+	combos := [][]providers.Slice{nil}
+	var pairs []providers.Slice // every airport pair of every slice
+	for _, sl := range req.Slices {
+		origins := s.airports.Expand(sl.Origin, req.NearbyKm)
+		dests := s.airports.Expand(sl.Destination, req.NearbyKm)
+		var legs []providers.Slice
+		for _, ij := range spread(len(origins), len(dests)) {
+			if o, d := origins[ij[0]], dests[ij[1]]; o != d {
+				legs = append(legs, providers.Slice{Origin: o, Destination: d, Date: sl.Date})
+			}
 		}
-		if all[i].DurationMin != all[j].DurationMin {
-			return all[i].DurationMin < all[j].DurationMin
+		pairs = append(pairs, legs...)
+
+		var next [][]providers.Slice
+		for _, ij := range spread(len(combos), len(legs)) {
+			if len(next) == limit {
+				break
+			}
+			next = append(next, append(slices.Clone(combos[ij[0]]), legs[ij[1]]))
 		}
-		return all[i].DepartAt.Before(all[j].DepartAt)
-	})
+		combos = next
+	}
+	if len(combos) == 0 {
+		return []providers.SearchRequest{req}, nil
+	}
 
-	res := SearchResult{Cheapest: cheapest, Fastest: fastest, All: all}
+	covered := make(map[providers.Slice]bool)
+	for _, c := range combos {
+		r := req
+		r.Slices = c
+		routes = append(routes, r)
+		for _, sl := range c {
+			covered[sl] = true
+		}
+	}
+	for _, sl := range pairs {
+		if !covered[sl] {
+			skipped = append(skipped, sl.Origin+"-"+sl.Destination)
+		}
+	}
+	return routes, skipped
+}
 
-	s.mu.Lock()
-	s.cache[key] = cacheEntry{value: res, expiresAt: time.Now().Add(s.cacheTTL)}
-	s.mu.Unlock()
+// routeCount is how many routes expandRoutes would search for req under the
+// service's cap alone.
+func (s *SearchService) routeCount(req providers.SearchRequest) int {
+	if s.airports == nil {
+		return 1
+	}
+	n := 1
+	for _, sl := range req.Slices {
+		legs := 0
+		for _, o := range s.airports.Expand(sl.Origin, req.NearbyKm) {
+			for _, d := range s.airports.Expand(sl.Destination, req.NearbyKm) {
+				if o != d {
+					legs++
+				}
+			}
+		}
+		n = min(n*legs, MaxRoutes)
+	}
+	return n
+}
 
-	return res, nil
+// spread orders the cells of an a×b grid so that the first max(a, b) of
+// them touch every row and column, the next max(a, b) pair each row and
+// column with a second one, and so on.
+func spread(a, b int) [][2]int {
+	out := make([][2]int, 0, a*b)
+	for p := range min(a, b) {
+		for k := range max(a, b) {
+			if a >= b {
+				out = append(out, [2]int{k, (k + p) % b})
+			} else {
+				out = append(out, [2]int{(k + p) % a, k})
+			}
+		}
+	}
+	return out
+}
+
+// routeLabel renders the airports of a request, e.g. LHR-BCN/BCN-LGW.
+func routeLabel(req providers.SearchRequest) string {
+	parts := make([]string, 0, len(req.Slices))
+	for _, sl := range req.Slices {
+		parts = append(parts, sl.Origin+"-"+sl.Destination)
+	}
+	return strings.Join(parts, "/")
+}
+
+// normalizeCurrency converts o to currency, remembering the quoted price.
+func (s *SearchService) normalizeCurrency(ctx context.Context, o providers.FlightOffer, currency string) (providers.FlightOffer, error) {
+	if s.converter == nil || o.Price.Currency == "" || strings.EqualFold(o.Price.Currency, currency) {
+		return o, nil
+	}
+	price, err := s.converter.Convert(ctx, o.Price, currency)
+	if err != nil {
+		return o, err
+	}
+	quoted := o.Price
+	o.OriginalPrice, o.Price = &quoted, price
+	return o, nil
+}
+
+func providerErrorStatus(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ProviderTimeout
+	case errors.Is(err, providers.ErrCircuitOpen):
+		return ProviderCircuitOpen
+	case errors.Is(err, providers.ErrQuotaExhausted):
+		return ProviderQuotaExhausted
+	case errors.Is(err, providers.ErrRateLimited):
+		return ProviderRateLimited
+	}
+	return ProviderError
+}
+
+// Breakers reports the circuit breaker of every provider that has one.
+func (s *SearchService) Breakers() []providers.BreakerStatus {
+	out := []providers.BreakerStatus{}
+	for _, p := range s.providers {
+		if b, ok := findProvider[interface {
+			BreakerStatus() providers.BreakerStatus
+		}](p); ok {
+			out = append(out, b.BreakerStatus())
+		}
+	}
+	return out
+}
+
+// Quotas reports the rate limiter and quota usage of every provider that
+// has them.
+func (s *SearchService) Quotas() []providers.Usage {
+	out := []providers.Usage{}
+	for _, p := range s.providers {
+		if u, ok := findProvider[interface{ Usage() providers.Usage }](p); ok {
+			out = append(out, u.Usage())
+		}
+	}
+	return out
+}
+
+// findProvider looks through p and the providers it wraps for one
+// implementing T.
+func findProvider[T any](p providers.FlightProvider) (T, bool) {
+	for p != nil {
+		if t, ok := p.(T); ok {
+			return t, true
+		}
+		w, ok := p.(interface {
+			Unwrap() providers.FlightProvider
+		})
+		if !ok {
+			break
+		}
+		p = w.Unwrap()
+	}
+	var zero T
+	return zero, false
 }
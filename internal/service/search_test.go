@@ -3,13 +3,17 @@ package service
 import (
 	"context"
 	"errors"
+	"net/http"
 	"reflect"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/you/go-jobsity-flights/internal/config"
+	"github.com/you/go-jobsity-flights/internal/money"
 	"github.com/you/go-jobsity-flights/internal/providers"
 )
 
@@ -24,8 +28,7 @@ func TestSearchCheapestFastest(t *testing.T) {
 		cfg: cfg,
 		offers: []providers.FlightOffer{
 			{Provider: "p1",
-				Price:       200,
-				Currency:    "EUR",
+				Price:       eur(200),
 				DurationMin: 120,
 				DepartAt:    time.Now(),
 				ArriveAt:    time.Now()},
@@ -35,8 +38,7 @@ func TestSearchCheapestFastest(t *testing.T) {
 		cfg: cfg,
 		offers: []providers.FlightOffer{
 			{Provider: "p2",
-				Price:       150,
-				Currency:    "EUR",
+				Price:       eur(150),
 				DurationMin: 90,
 				DepartAt:    time.Now(),
 				ArriveAt:    time.Now()},
@@ -45,8 +47,7 @@ func TestSearchCheapestFastest(t *testing.T) {
 		cfg: cfg,
 		offers: []providers.FlightOffer{
 			{Provider: "p3",
-				Price:       300,
-				Currency:    "EUR",
+				Price:       eur(300),
 				DurationMin: 60,
 				DepartAt:    time.Now(),
 				ArriveAt:    time.Now()},
@@ -55,7 +56,7 @@ func TestSearchCheapestFastest(t *testing.T) {
 	svc := NewSearchService([]providers.FlightProvider{p1, p2, p3},
 		cfg.SearchTimeout,
 		cfg.CacheTTL)
-	res, err := svc.Search(context.Background(), "AMS", "BCN", "2025-10-01")
+	res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -74,6 +75,10 @@ func valToPtr[T any](param T) *T {
 	return &param
 }
 
+func eur(v float64) money.Money {
+	return money.FromFloat(v, "EUR")
+}
+
 func TestSearchError(t *testing.T) {
 
 	cfg := &config.Config{
@@ -89,8 +94,7 @@ func TestSearchError(t *testing.T) {
 		cfg: cfg,
 		offers: []providers.FlightOffer{
 			{Provider: "p2",
-				Price:       150,
-				Currency:    "EUR",
+				Price:       eur(150),
 				DurationMin: 90,
 				DepartAt:    time.Now(),
 				ArriveAt:    time.Now()},
@@ -99,8 +103,7 @@ func TestSearchError(t *testing.T) {
 		cfg: cfg,
 		offers: []providers.FlightOffer{
 			{Provider: "p3",
-				Price:       300,
-				Currency:    "EUR",
+				Price:       eur(300),
 				DurationMin: 60,
 				DepartAt:    time.Now(),
 				ArriveAt:    time.Now()},
@@ -109,9 +112,44 @@ func TestSearchError(t *testing.T) {
 	svc := NewSearchService([]providers.FlightProvider{p1, p2, p3},
 		cfg.SearchTimeout,
 		cfg.CacheTTL)
-	_, err := svc.Search(context.Background(), "AMS", "BCN", "2025-10-01")
+	res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.True(t, res.Partial)
+	require.Len(t, res.All, 2)
+	require.Equal(t, "p2", res.Cheapest.Provider)
+	require.Len(t, res.Providers, 3)
+	require.Equal(t, "p1", res.Providers[0].Provider)
+	require.Equal(t, ProviderError, res.Providers[0].Status)
+	require.Equal(t, "p1: API Request Fail", res.Providers[0].Error)
+	require.Equal(t, ProviderOK, res.Providers[1].Status)
+	require.Equal(t, 1, res.Providers[1].Offers)
+	require.Equal(t, ProviderOK, res.Providers[2].Status)
+}
+
+func TestSearchAllProvidersFail(t *testing.T) {
+
+	cfg := &config.Config{
+		SearchTimeout: 5 * time.Second,
+		CacheTTL:      5 * time.Second,
+	}
+
+	p1 := ProviderMock{name: "p1",
+		cfg:             cfg,
+		errorOutMessage: valToPtr("API Request Fail"),
+	}
+	p2 := ProviderMock{name: "p2",
+		cfg:             cfg,
+		errorOutMessage: valToPtr("missing API key"),
+	}
+
+	svc := NewSearchService([]providers.FlightProvider{p1, p2},
+		cfg.SearchTimeout,
+		cfg.CacheTTL)
+	res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
 	require.Error(t, err)
-	require.Equal(t, "p1: API Request Fail", err.Error())
+	require.Equal(t, "p1: API Request Fail\np2: missing API key", err.Error())
+	require.Len(t, res.Providers, 2)
+	require.Equal(t, ProviderError, res.Providers[1].Status)
 }
 
 func TestSearchTimeOut(t *testing.T) {
@@ -129,8 +167,7 @@ func TestSearchTimeOut(t *testing.T) {
 		cfg: cfg,
 		offers: []providers.FlightOffer{
 			{Provider: "p2",
-				Price:       150,
-				Currency:    "EUR",
+				Price:       eur(150),
 				DurationMin: 90,
 				DepartAt:    time.Now(),
 				ArriveAt:    time.Now()},
@@ -139,8 +176,7 @@ func TestSearchTimeOut(t *testing.T) {
 		cfg: cfg,
 		offers: []providers.FlightOffer{
 			{Provider: "p3",
-				Price:       300,
-				Currency:    "EUR",
+				Price:       eur(300),
 				DurationMin: 60,
 				DepartAt:    time.Now(),
 				ArriveAt:    time.Now()},
@@ -149,7 +185,19 @@ func TestSearchTimeOut(t *testing.T) {
 	svc := NewSearchService([]providers.FlightProvider{p1, p2, p3},
 		cfg.SearchTimeout,
 		cfg.CacheTTL)
-	_, err := svc.Search(context.Background(), "AMS", "BCN", "2025-10-01")
+	res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.True(t, res.Partial)
+	require.Len(t, res.All, 2)
+	require.Equal(t, ProviderTimeout, res.Providers[0].Status)
+	require.Equal(t, ProviderOK, res.Providers[1].Status)
+	require.Equal(t, ProviderOK, res.Providers[2].Status)
+
+	// when nothing comes back in time the deadline is surfaced to the caller
+	slow := NewSearchService([]providers.FlightProvider{p1},
+		cfg.SearchTimeout,
+		cfg.CacheTTL)
+	_, err = slow.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
 	require.Error(t, err)
 	if !errors.Is(err, context.DeadlineExceeded) {
 		t.Fatalf("expected context deadline exceeded, got %v", err)
@@ -173,7 +221,7 @@ func TestSearch_NoOffers(t *testing.T) {
 		cfg.SearchTimeout,
 		cfg.CacheTTL)
 
-	_, err := s.Search(context.Background(), "AAA", "BBB", "2025-01-01")
+	_, err := s.Search(context.Background(), providers.OneWay("AAA", "BBB", "2025-01-01"))
 	if err == nil {
 		t.Fatalf("expected 'no offers found' error, got nil")
 	}
@@ -196,8 +244,7 @@ func TestSearch_CacheHit(t *testing.T) {
 		callCount: &calls,
 		offers: []providers.FlightOffer{
 			{Provider: "p2",
-				Price:       150,
-				Currency:    "EUR",
+				Price:       eur(150),
 				DurationMin: 90,
 				DepartAt:    time.Now(),
 				ArriveAt:    time.Now()},
@@ -209,7 +256,7 @@ func TestSearch_CacheHit(t *testing.T) {
 		cfg.CacheTTL)
 
 	ctx := context.Background()
-	res1, err := s.Search(ctx, "GRU", "JFK", "2025-09-15")
+	res1, err := s.Search(ctx, providers.OneWay("GRU", "JFK", "2025-09-15"))
 	if err != nil {
 		t.Fatalf("first Search error: %v", err)
 	}
@@ -219,7 +266,7 @@ func TestSearch_CacheHit(t *testing.T) {
 
 	{
 		// Same key -> should hit cache, not call provider again
-		res2, err := s.Search(ctx, "GRU", "JFK", "2025-09-15")
+		res2, err := s.Search(ctx, providers.OneWay("GRU", "JFK", "2025-09-15"))
 		if err != nil {
 			t.Fatalf("second Search (cache) error: %v", err)
 		}
@@ -236,7 +283,7 @@ func TestSearch_CacheHit(t *testing.T) {
 
 	{
 		// Same key -> should hit cache, not call provider again
-		res2, err := s.Search(ctx, "GRU", "JFK", "2025-09-15")
+		res2, err := s.Search(ctx, providers.OneWay("GRU", "JFK", "2025-09-15"))
 		if err != nil {
 			t.Fatalf("second Search (cache) error: %v", err)
 		}
@@ -250,3 +297,490 @@ func TestSearch_CacheHit(t *testing.T) {
 	}
 
 }
+
+func TestSearch_RoundTripCachedSeparately(t *testing.T) {
+	cfg := &config.Config{
+		SearchTimeout: 5 * time.Second,
+		CacheTTL:      5 * time.Second,
+	}
+
+	var calls int32
+	prov := &ProviderMock{name: "p1",
+		cfg:       cfg,
+		callCount: &calls,
+		offers: []providers.FlightOffer{
+			{Provider: "p1",
+				Price:       eur(150),
+				DurationMin: 90,
+				DepartAt:    time.Now(),
+				ArriveAt:    time.Now()},
+		},
+	}
+
+	s := NewSearchService([]providers.FlightProvider{prov},
+		cfg.SearchTimeout,
+		cfg.CacheTTL)
+
+	ctx := context.Background()
+	_, err := s.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	_, err = s.Search(ctx, providers.RoundTrip("AMS", "BCN", "2025-10-01", "2025-10-08"))
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	_, err = s.Search(ctx, providers.SearchRequest{})
+	require.Error(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestSearch_PassengerOptionsInCacheKey(t *testing.T) {
+	cfg := &config.Config{
+		SearchTimeout: 5 * time.Second,
+		CacheTTL:      5 * time.Second,
+	}
+
+	var calls int32
+	prov := &ProviderMock{name: "p1",
+		cfg:       cfg,
+		callCount: &calls,
+		offers: []providers.FlightOffer{
+			{Provider: "p1", Price: eur(150), DurationMin: 90},
+		},
+	}
+	s := NewSearchService([]providers.FlightProvider{prov},
+		cfg.SearchTimeout,
+		cfg.CacheTTL)
+
+	ctx := context.Background()
+	solo := providers.OneWay("AMS", "BCN", "2025-10-01")
+	_, err := s.Search(ctx, solo)
+	require.NoError(t, err)
+
+	// explicit defaults share the cache entry with the implicit ones
+	explicit := solo
+	explicit.Passengers = providers.Passengers{Adults: 1}
+	explicit.Cabin = providers.CabinEconomy
+	explicit.Currency = "eur"
+	_, err = s.Search(ctx, explicit)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	family := solo
+	family.Passengers = providers.Passengers{Adults: 2, Children: 1, Infants: 1}
+	_, err = s.Search(ctx, family)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	business := solo
+	business.Cabin = providers.CabinBusiness
+	_, err = s.Search(ctx, business)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	bad := solo
+	bad.Passengers = providers.Passengers{Adults: 1, Infants: 2}
+	_, err = s.Search(ctx, bad)
+	require.EqualError(t, err, "each infant must travel with an adult")
+
+	bad = solo
+	bad.Cabin = "lounge"
+	_, err = s.Search(ctx, bad)
+	require.Error(t, err)
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+type fixedRates map[string]float64 // units per EUR
+
+func (r fixedRates) Convert(_ context.Context, m money.Money, to string) (money.Money, error) {
+	rf, ok := r[m.Currency]
+	if !ok {
+		return money.Money{}, errors.New("no rate for " + m.Currency)
+	}
+	return money.FromFloat(m.Float()/rf*r[to], to), nil
+}
+
+func TestSearch_NormalizesCurrency(t *testing.T) {
+	cfg := &config.Config{
+		SearchTimeout: 5 * time.Second,
+		CacheTTL:      5 * time.Second,
+	}
+	p1 := ProviderMock{name: "p1", cfg: cfg, offers: []providers.FlightOffer{
+		{Provider: "p1", Price: eur(120), DurationMin: 90},
+	}}
+	// 130 USD is cheaper than 120 EUR at 1.25 USD/EUR
+	p2 := ProviderMock{name: "p2", cfg: cfg, offers: []providers.FlightOffer{
+		{Provider: "p2", Price: money.FromFloat(130, "USD"), DurationMin: 100},
+		{Provider: "p2", Price: money.FromFloat(10, "XXX"), DurationMin: 100},
+	}}
+
+	svc := NewSearchService([]providers.FlightProvider{p1, p2}, cfg.SearchTimeout, cfg.CacheTTL,
+		WithConverter(fixedRates{"EUR": 1, "USD": 1.25}))
+	res, err := svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.Len(t, res.All, 2, "unconvertible offers are dropped")
+	require.Equal(t, ProviderOK, res.Providers[1].Status)
+	require.Equal(t, 1, res.Providers[1].Offers)
+	require.Equal(t, "1 offers dropped: no rate for XXX", res.Providers[1].Error)
+	require.Empty(t, res.Providers[0].Error)
+
+	require.Equal(t, "p2", res.Cheapest.Provider)
+	require.Equal(t, eur(104), res.Cheapest.Price)
+	require.Equal(t, money.New(13000, "USD"), *res.Cheapest.OriginalPrice)
+
+	require.Equal(t, eur(120), res.All[1].Price)
+	require.Nil(t, res.All[1].OriginalPrice)
+}
+
+// routeRecorder answers every route with one offer and remembers what it
+// was asked for.
+type routeRecorder struct {
+	mu     sync.Mutex
+	routes []string
+}
+
+func (p *routeRecorder) Name() string { return "routes" }
+
+func (p *routeRecorder) Search(_ context.Context, req providers.SearchRequest) ([]providers.FlightOffer, error) {
+	p.mu.Lock()
+	p.routes = append(p.routes, req.Slices[0].Origin+"-"+req.Slices[0].Destination)
+	p.mu.Unlock()
+	price := eur(100)
+	if req.Slices[0].Origin == "LGW" {
+		price = eur(80)
+	}
+	return []providers.FlightOffer{{Provider: "routes", Price: price, DurationMin: 120}}, nil
+}
+
+func TestSearch_ExpandsCityCodes(t *testing.T) {
+	p := &routeRecorder{}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute)
+
+	res, err := svc.Search(context.Background(), providers.OneWay("LON", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"LHR-BCN", "LGW-BCN", "STN-BCN", "LTN-BCN", "LCY-BCN", "SEN-BCN"}, p.routes)
+	require.Len(t, res.Providers, 6)
+	require.Equal(t, "LGW-BCN", res.Cheapest.Route)
+	for _, st := range res.Providers {
+		require.NotEmpty(t, st.Route)
+	}
+}
+
+func TestSearch_NearbyAirports(t *testing.T) {
+	p := &routeRecorder{}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute)
+
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+	_, err := svc.Search(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, []string{"AMS-BCN"}, p.routes)
+
+	req.NearbyKm = 120
+	res, err := svc.Search(context.Background(), req)
+	require.NoError(t, err)
+	require.Contains(t, p.routes, "AMS-GRO")
+	require.Contains(t, p.routes, "AMS-REU")
+	require.Contains(t, p.routes, "RTM-BCN")
+	require.Len(t, res.Providers, len(p.routes)-1)
+
+	req.NearbyKm = 500
+	_, err = svc.Search(context.Background(), req)
+	require.Error(t, err)
+}
+
+func TestSearch_RouteCap(t *testing.T) {
+	p := &routeRecorder{}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute)
+
+	// six London airports × three New York airports exceeds the cap
+	res, err := svc.Search(context.Background(), providers.OneWay("LON", "NYC", "2025-10-01"))
+	require.NoError(t, err)
+	require.Len(t, p.routes, MaxRoutes)
+
+	// the cap is spread: every airport is searched, each London one twice
+	origins, dests := map[string]int{}, map[string]int{}
+	for _, r := range p.routes {
+		o, d, _ := strings.Cut(r, "-")
+		origins[o]++
+		dests[d]++
+	}
+	require.Equal(t, map[string]int{"LHR": 2, "LGW": 2, "STN": 2, "LTN": 2, "LCY": 2, "SEN": 2}, origins)
+	require.Equal(t, map[string]int{"JFK": 4, "LGA": 4, "EWR": 4}, dests)
+
+	// and what it left out is reported
+	require.True(t, res.Partial)
+	require.Len(t, res.SkippedRoutes, 18-MaxRoutes)
+	for _, r := range res.SkippedRoutes {
+		require.NotContains(t, p.routes, r)
+	}
+
+	p.routes = nil
+	req := providers.OneWay("LON", "NYC", "2025-10-02")
+	req.MaxRoutes = 3
+	res, err = svc.Search(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, p.routes, 3)
+	require.Len(t, res.SkippedRoutes, 15)
+}
+
+func TestSearch_WithoutAirportsNoExpansion(t *testing.T) {
+	p := &routeRecorder{}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute, WithAirports(nil))
+
+	res, err := svc.Search(context.Background(), providers.OneWay("LON", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"LON-BCN"}, p.routes)
+	require.Empty(t, res.Cheapest.Route)
+}
+
+func TestSearch_CoalescesConcurrentCalls(t *testing.T) {
+	var calls int32
+	p := ProviderMock{name: "slow", delay: 100 * time.Millisecond, callCount: &calls,
+		offers: []providers.FlightOffer{{Provider: "slow", Price: eur(100), DurationMin: 60}}}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute)
+
+	var wg sync.WaitGroup
+	results := make([]SearchResult, 50)
+	errs := make([]error, 50)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = svc.Search(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"))
+		}()
+	}
+	wg.Wait()
+
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+	for i := range results {
+		require.NoError(t, errs[i])
+		require.Equal(t, "slow", results[i].Cheapest.Provider)
+	}
+}
+
+func TestSearch_LeaderCancelDoesNotFailFollowers(t *testing.T) {
+	var calls int32
+	p := ProviderMock{name: "slow", delay: 200 * time.Millisecond, callCount: &calls,
+		offers: []providers.FlightOffer{{Provider: "slow", Price: eur(100), DurationMin: 60}}}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute)
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := svc.Search(leaderCtx, req)
+		leaderErr <- err
+	}()
+	time.Sleep(30 * time.Millisecond)
+
+	followerDone := make(chan struct{})
+	var res SearchResult
+	var err error
+	go func() {
+		defer close(followerDone)
+		res, err = svc.Search(context.Background(), req)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	cancelLeader()
+
+	require.ErrorIs(t, <-leaderErr, context.Canceled)
+	<-followerDone
+	require.NoError(t, err)
+	require.Equal(t, "slow", res.Cheapest.Provider)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	// the shared result was cached for later callers too
+	_, err = svc.Search(context.Background(), req)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
+
+func TestSearch_BoundedCacheEvicts(t *testing.T) {
+	var calls int32
+	p := ProviderMock{name: "p1", callCount: &calls,
+		offers: []providers.FlightOffer{{Provider: "p1", Price: eur(100), DurationMin: 60}}}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute,
+		WithCache(NewResultCache(1, 0)))
+	ctx := context.Background()
+
+	_, err := svc.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	_, err = svc.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	_, err = svc.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-02")) // evicts 10-01
+	require.NoError(t, err)
+	_, err = svc.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+
+	st := svc.CacheStats()
+	require.EqualValues(t, 1, st.Hits)
+	require.EqualValues(t, 2, st.Evictions)
+	require.Equal(t, 1, st.Entries)
+}
+
+func TestSearch_ServesStaleWhileRevalidating(t *testing.T) {
+	var calls int32
+	p := ProviderMock{name: "p1", callCount: &calls, delay: 50 * time.Millisecond,
+		offers: []providers.FlightOffer{{Provider: "p1", Price: eur(100), DurationMin: 60}}}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, 50*time.Millisecond,
+		WithStaleWindow(time.Minute))
+	ctx := context.Background()
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+
+	_, fr, err := svc.SearchWithFreshness(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, Freshness{Source: SourceProviders}, fr)
+
+	_, fr, err = svc.SearchWithFreshness(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, SourceCache, fr.Source)
+	require.False(t, fr.Stale)
+
+	time.Sleep(80 * time.Millisecond)
+	start := time.Now()
+	res, fr, err := svc.SearchWithFreshness(ctx, req)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 40*time.Millisecond, "stale result must not wait for providers")
+	require.True(t, fr.Stale)
+	require.GreaterOrEqual(t, fr.Age, 80*time.Millisecond)
+	require.Equal(t, "p1", res.Cheapest.Provider)
+
+	// the background refresh replaces the entry with a fresh one
+	require.Eventually(t, func() bool {
+		_, fr, _ := svc.SearchWithFreshness(ctx, req)
+		return !fr.Stale
+	}, time.Second, 10*time.Millisecond)
+	require.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+func TestSearch_FailedRefreshKeepsStaleResult(t *testing.T) {
+	var calls int32
+	prov := &switchableProvider{calls: &calls}
+	svc := NewSearchService([]providers.FlightProvider{prov}, time.Second, 20*time.Millisecond,
+		WithStaleWindow(time.Minute), WithNegativeTTL(time.Minute))
+	ctx := context.Background()
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+
+	_, err := svc.Search(ctx, req)
+	require.NoError(t, err)
+
+	prov.fail.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	_, fr, err := svc.SearchWithFreshness(ctx, req)
+	require.NoError(t, err)
+	require.True(t, fr.Stale)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second, 5*time.Millisecond)
+
+	res, fr, err := svc.SearchWithFreshness(ctx, req)
+	require.NoError(t, err)
+	require.True(t, fr.Stale)
+	require.Equal(t, "switch", res.Cheapest.Provider)
+}
+
+func TestSearch_NegativeCaching(t *testing.T) {
+	var calls int32
+	p := ProviderMock{name: "p1", callCount: &calls, errorOutMessage: valToPtr("upstream down")}
+	svc := NewSearchService([]providers.FlightProvider{p}, time.Second, time.Minute,
+		WithNegativeTTL(50*time.Millisecond))
+	ctx := context.Background()
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+
+	res, err := svc.Search(ctx, req)
+	require.EqualError(t, err, "p1: upstream down")
+	require.True(t, res.Partial)
+
+	res, fr, err := svc.SearchWithFreshness(ctx, req)
+	require.EqualError(t, err, "p1: upstream down")
+	require.Equal(t, SourceCache, fr.Source)
+	require.True(t, res.Partial)
+	require.Len(t, res.Providers, 1)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = svc.Search(ctx, req)
+	require.Error(t, err)
+	require.EqualValues(t, 2, atomic.LoadInt32(&calls))
+}
+
+// switchableProvider succeeds until fail is set.
+type switchableProvider struct {
+	calls *int32
+	fail  atomic.Bool
+}
+
+func (p *switchableProvider) Name() string { return "switch" }
+
+func (p *switchableProvider) Search(context.Context, providers.SearchRequest) ([]providers.FlightOffer, error) {
+	atomic.AddInt32(p.calls, 1)
+	if p.fail.Load() {
+		return nil, errors.New("switch: down")
+	}
+	return []providers.FlightOffer{{Provider: "switch", Price: eur(90), DurationMin: 60}}, nil
+}
+
+func TestSearch_ReportsOpenBreakers(t *testing.T) {
+	failing := ProviderMock{name: "flaky", errorOutMessage: valToPtr("boom")}
+	down := providers.NewResilient(&statusProvider{code: 503}, providers.RetryPolicy{MaxAttempts: 1},
+		providers.BreakerPolicy{FailureThreshold: 1, Cooldown: time.Minute})
+	ok := ProviderMock{name: "ok", offers: []providers.FlightOffer{{Provider: "ok", Price: eur(100), DurationMin: 60}}}
+	svc := NewSearchService([]providers.FlightProvider{failing, down, ok}, time.Second, time.Millisecond)
+	ctx := context.Background()
+
+	_, err := svc.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	res, err := svc.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-02"))
+	require.NoError(t, err)
+	require.True(t, res.Partial)
+	require.Equal(t, ProviderCircuitOpen, res.Providers[1].Status)
+
+	br := svc.Breakers()
+	require.Len(t, br, 1)
+	require.Equal(t, "status", br[0].Provider)
+	require.Equal(t, providers.BreakerOpen, br[0].State)
+}
+
+// statusProvider fails every call with an HTTP status.
+type statusProvider struct{ code int }
+
+func (p *statusProvider) Name() string { return "status" }
+
+func (p *statusProvider) Search(context.Context, providers.SearchRequest) ([]providers.FlightOffer, error) {
+	return nil, &providers.StatusError{Op: "status", StatusCode: p.code, Status: http.StatusText(p.code)}
+}
+
+func TestSearch_ReportsExhaustedQuota(t *testing.T) {
+	limited := providers.NewResilient(&limitedProvider{limiter: providers.NewLimiter("limited", config.RateLimit{Daily: 1})},
+		providers.DefaultRetryPolicy, providers.DefaultBreakerPolicy)
+	ok := ProviderMock{name: "ok", offers: []providers.FlightOffer{{Provider: "ok", Price: eur(100), DurationMin: 60}}}
+	svc := NewSearchService([]providers.FlightProvider{limited, ok}, time.Second, time.Millisecond)
+	ctx := context.Background()
+
+	res, err := svc.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-01"))
+	require.NoError(t, err)
+	require.Equal(t, ProviderOK, res.Providers[0].Status)
+	res, err = svc.Search(ctx, providers.OneWay("AMS", "BCN", "2025-10-02"))
+	require.NoError(t, err)
+	require.True(t, res.Partial)
+	require.Equal(t, ProviderQuotaExhausted, res.Providers[0].Status)
+
+	q := svc.Quotas()
+	require.Len(t, q, 1, "found through the resilient wrapper")
+	require.Equal(t, "limited", q[0].Provider)
+	require.Equal(t, 1, q[0].Daily)
+	require.True(t, q[0].Exhausted)
+	require.Equal(t, providers.BreakerClosed, svc.Breakers()[0].State)
+}
+
+// limitedProvider passes every call through a rate limiter.
+type limitedProvider struct{ limiter *providers.Limiter }
+
+func (p *limitedProvider) Name() string { return "limited" }
+
+func (p *limitedProvider) Usage() providers.Usage { return p.limiter.Usage() }
+
+func (p *limitedProvider) Search(ctx context.Context, _ providers.SearchRequest) ([]providers.FlightOffer, error) {
+	if err := p.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return []providers.FlightOffer{{Provider: "limited", Price: eur(120), DurationMin: 90}}, nil
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+// SearchStream is SearchWithFreshness for clients that render results as
+// they come in: onResult is called with every provider's offers the moment
+// its call finishes, then the merged and ranked result is returned. A
+// cached result is returned straight away without calling onResult.
+//
+// A streamed search is not shared with concurrent identical searches,
+// because each stream needs its own per-provider results, but what it
+// finds is cached for them. onResult runs on the calling goroutine.
+func (s *SearchService) SearchStream(ctx context.Context, req providers.SearchRequest, onResult func(ProviderResult)) (SearchResult, Freshness, error) {
+	req = req.WithDefaults()
+	if err := req.Validate(); err != nil {
+		return SearchResult{}, Freshness{}, err
+	}
+	key := s.cacheKey(req)
+	if e, fr, ok := s.lookup(ctx, key, req); ok {
+		return e.Result, fr, e.err()
+	}
+
+	res, err := s.fanOut(ctx, req, onResult)
+	if ctx.Err() == nil { // a stream cut short by its client is not a result
+		s.store(key, res, err)
+	}
+	return res, Freshness{Source: SourceProviders}, err
+}
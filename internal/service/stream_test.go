@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/you/go-jobsity-flights/internal/providers"
+)
+
+func TestSearchStream_EmitsEachProviderAsItAnswers(t *testing.T) {
+	fast := ProviderMock{name: "fast", offers: []providers.FlightOffer{{Provider: "fast", Price: eur(200), DurationMin: 60}}}
+	slow := ProviderMock{name: "slow", delay: 50 * time.Millisecond, offers: []providers.FlightOffer{{Provider: "slow", Price: eur(100), DurationMin: 90}}}
+	failing := ProviderMock{name: "failing", errorOutMessage: valToPtr("boom")}
+	svc := NewSearchService([]providers.FlightProvider{slow, failing, fast}, time.Second, time.Minute)
+	ctx := context.Background()
+	req := providers.OneWay("AMS", "BCN", "2025-10-01")
+
+	var events []ProviderResult
+	var arrived []time.Duration
+	start := time.Now()
+	res, fr, err := svc.SearchStream(ctx, req, func(pr ProviderResult) {
+		events = append(events, pr)
+		arrived = append(arrived, time.Since(start))
+	})
+	require.NoError(t, err)
+	require.Equal(t, SourceProviders, fr.Source)
+	require.Len(t, events, 3)
+	require.Equal(t, "slow", events[2].Provider, "the slow provider is reported last")
+	require.Less(t, arrived[0], 40*time.Millisecond, "the first results do not wait for the slow one")
+	status := map[string]string{}
+	for _, e := range events {
+		status[e.Provider] = e.Status
+	}
+	require.Equal(t, map[string]string{"fast": ProviderOK, "failing": ProviderError, "slow": ProviderOK}, status)
+	require.Len(t, events[2].Results, 1)
+
+	require.True(t, res.Partial)
+	require.Equal(t, "slow", res.Cheapest.Provider)
+	require.Equal(t, "fast", res.Fastest.Provider)
+
+	// the streamed result was cached: no more per-provider events
+	events = nil
+	res2, fr, err := svc.SearchStream(ctx, req, func(pr ProviderResult) { events = append(events, pr) })
+	require.NoError(t, err)
+	require.Equal(t, SourceCache, fr.Source)
+	require.Empty(t, events)
+	require.Equal(t, res.Cheapest.Price, res2.Cheapest.Price)
+}
+
+func TestSearchStream_ReportsTimeouts(t *testing.T) {
+	stuck := ProviderMock{name: "stuck", delay: time.Second}
+	svc := NewSearchService([]providers.FlightProvider{stuck}, 20*time.Millisecond, time.Minute)
+
+	var events []ProviderResult
+	_, _, err := svc.SearchStream(context.Background(), providers.OneWay("AMS", "BCN", "2025-10-01"), func(pr ProviderResult) {
+		events = append(events, pr)
+	})
+	require.Error(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, ProviderTimeout, events[0].Status)
+}